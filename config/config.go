@@ -3,87 +3,344 @@ package config
 import (
     "log"
     ut "debounce_grep/utilities"
+    "errors"
     "flag"
-    "os"
+    "fmt"
     "strconv"
     "strings"
 )
 
-//Each config option is represented by one of three types of structs:
-//IntConfigOption, StringConfigOption, or BooleanConfigOption. Each looks
+//Each config option is represented by one of five types of structs:
+//IntConfigOption, StringConfigOption, BooleanConfigOption,
+//ChoiceConfigOption, or TextConfigOption. Each looks
 //for flags first, then environmental variables, and if neither are found
 //returns a default value. Each has similar but different enough behavior
-//that I don't think inheritance is necessarily merited.
-
-var (
-    //define variables for flags that take multiple options
-    dirsToSearchFlag MultiValueFlag
-    fileShebangsFlag MultiValueFlag
-    toIgnoreFlag MultiValueFlag
-
-    intOptions = []IntConfigOption {
-        IntConfigOption {
-            name: "debounceTimeMs",
-            defaultValue: 200,
-            envVariableName: "DEBOUNCE_GREP_DEBOUNCE_TIME_MS",
-            flagSymbol: "ms",
-            description: "Time between debounced searches, in MS.",
-        },
-        IntConfigOption {
-            name: "maxLinesToPrintPerFile",
-            defaultValue: 5,
-            envVariableName: "DEBOUNCE_GREP_MAX_LINES_PER_FILE",
-            flagSymbol: "lines",
-            description: "Max number of lines of matches to print per file.",
-        },
+//that I don't think inheritance is necessarily merited. Flags only take
+//precedence if they were actually passed on the command line, which is
+//tracked with flag.Visit() after parsing, so a flag can be used to set an
+//option to its zero value (e.g. --whole-lines=false or -lines 0).
+//
+//Nothing is parsed at package init: New() is handed the args and environ
+//to read from, so a Config can be built for tests or other tools without
+//touching os.Args or the process environment.
+
+//Values of all config options, see newConfigOptions() for descriptions
+type Config struct {
+    DebounceTimeMs int
+    MaxLinesToPrintPerFile int
+    DirsToSearch []string
+    FileShebangs []string
+    PatternsToIgnore []string
+    ShouldPrintWholeLines bool
+    HistorySize int
+    QueryScope string
+    IsFuzzy bool
+    IsSyntaxHighlighted bool
+    IsMouseEnabled bool
+    SearchArchives bool
+    Follow bool
+    //lines kept of each file that's followed, the oldest being dropped
+    FollowMaxLines int
+    SortMode string
+    MatchTarget string
+    PreviewPosition string
+    //KEY=ACTION bindings of keys to scroll through matches with
+    Bindings []string
+    //KEY=COMMAND bindings of keys to shell commands run on the selection
+    Commands []string
+    JumpMinMatches int
+    //seconds commands run for the pager can take before they're killed, 0
+    //for no limit
+    CommandTimeoutSeconds int
+    Theme string
+    //what's printed for the selected file when accepting it
+    PrintFormat string
+    //run with what's copied on its stdin, as well as copying it with OSC 52
+    ClipboardCommand string
+    //ROLE=COLOR overrides of the theme's colors
+    Colors []string
+    //not options either, read from NO_COLOR, TERM and COLORTERM
+    IsColorDisabled bool
+    IsTrueColorSupported bool
+    //not an option itself - where data like the query history is kept,
+    //see utilities.GetDataDir()
+    DataDir string
+}
+
+//New parses args (not including the program name, e.g. os.Args[1:]) and
+//environ (in the "KEY=value" form of os.Environ()) into a Config. Args that
+//aren't flags are taken as directories to search. The returned error is
+//flag.ErrHelp if -h or --help was passed.
+func New(args []string, environ []string) (*Config, error) {
+    config := &Config{}
+    configOptions := newConfigOptions(config)
+    flagSet := flag.NewFlagSet("debounce_grep", flag.ContinueOnError)
+    //need to define all flag parsers before calling flagSet.Parse()
+    configOptions.defineFlags(flagSet)
+    if err := flagSet.Parse(args); err != nil {
+        return nil, err
     }
+    flagSet.Visit(func(f *flag.Flag) {
+        configOptions.setFlags[f.Name] = true
+    })
+    configOptions.env = parseEnviron(environ)
+    dirsToSearch, err := ut.GetDirsToSearch(flagSet.Args())
+    if err != nil {
+        return nil, err
+    }
+    configOptions.setDefaultValue("dirsToSearch", dirsToSearch)
+    if err := configOptions.parseAndSaveValues(); err != nil {
+        return nil, err
+    }
+    config.DataDir = ut.GetDataDir(configOptions.env["XDG_DATA_HOME"], configOptions.env["HOME"])
+    //see https://no-color.org
+    config.IsColorDisabled = configOptions.env["NO_COLOR"] != "" || configOptions.env["TERM"] == "dumb"
+    config.IsTrueColorSupported = configOptions.env["COLORTERM"] == "truecolor" || configOptions.env["COLORTERM"] == "24bit"
+    return config, nil
+}
 
-    stringOptions = []StringConfigOption {
-        StringConfigOption {
-            name: "dirsToSearch",
-            defaultValue: ut.GetDirsToSearch(),
-            envVariableName: "DEBOUNCE_GREP_DIRS_TO_SEARCH",
-            flagSymbol: "dir",
-            flag: dirsToSearchFlag,
-            description: "Directories to search.",
+func newConfigOptions(config *Config) *ConfigOptions {
+    return &ConfigOptions{
+        intOptions: []IntConfigOption {
+            IntConfigOption {
+                name: "debounceTimeMs",
+                defaultValue: 200,
+                envVariableName: "DEBOUNCE_GREP_DEBOUNCE_TIME_MS",
+                flagSymbol: "ms",
+                description: "Time between debounced searches, in MS. 0 searches on every keystroke.",
+                minValue: 0,
+                target: &config.DebounceTimeMs,
+            },
+            IntConfigOption {
+                name: "maxLinesToPrintPerFile",
+                defaultValue: 5,
+                envVariableName: "DEBOUNCE_GREP_MAX_LINES_PER_FILE",
+                flagSymbol: "lines",
+                description: "Max number of lines of matches to print per file. 0 prints all lines.",
+                minValue: 0,
+                target: &config.MaxLinesToPrintPerFile,
+            },
+            IntConfigOption {
+                name: "historySize",
+                defaultValue: 500,
+                envVariableName: "DEBOUNCE_GREP_HISTORY_SIZE",
+                flagSymbol: "history-size",
+                description: "Max number of queries to keep in the search history. 0 disables the history.",
+                minValue: 0,
+                target: &config.HistorySize,
+            },
+            IntConfigOption {
+                name: "jumpMinMatches",
+                defaultValue: 5,
+                envVariableName: "DEBOUNCE_GREP_JUMP_MIN_MATCHES",
+                flagSymbol: "jump-matches",
+                description: "Min number of matches of the files next-file-with-matches and previous-file-with-matches jump to.",
+                minValue: 1,
+                target: &config.JumpMinMatches,
+            },
+            IntConfigOption {
+                name: "followMaxLines",
+                defaultValue: 1000,
+                envVariableName: "DEBOUNCE_GREP_FOLLOW_MAX_LINES",
+                flagSymbol: "follow-lines",
+                description: "Max number of matched lines kept of each file in follow mode, the oldest lines being dropped as new ones match.",
+                minValue: 1,
+                target: &config.FollowMaxLines,
+            },
+            IntConfigOption {
+                name: "commandTimeoutSeconds",
+                defaultValue: 30,
+                envVariableName: "DEBOUNCE_GREP_COMMAND_TIMEOUT",
+                flagSymbol: "command-timeout",
+                description: "Seconds a command whose output is shown in the pager can run for before it's killed. 0 lets commands run until they're cancelled with C-g or escape.",
+                minValue: 0,
+                target: &config.CommandTimeoutSeconds,
+            },
         },
-        StringConfigOption {
-            name: "fileShebangs",
-            defaultValue: []string{},
-            envVariableName: "DEBOUNCE_GREP_FILE_SHEBANGS",
-            flagSymbol: "shebang",
-            flag: fileShebangsFlag,
-            description: "Shebangs of files to search.",
+        stringOptions: []StringConfigOption {
+            StringConfigOption {
+                name: "dirsToSearch",
+                //set in New() once the non-flag args are known
+                defaultValue: nil,
+                envVariableName: "DEBOUNCE_GREP_DIRS_TO_SEARCH",
+                flagSymbol: "dir",
+                description: "Directories to search.",
+                target: &config.DirsToSearch,
+            },
+            StringConfigOption {
+                name: "fileShebangs",
+                defaultValue: []string{},
+                envVariableName: "DEBOUNCE_GREP_FILE_SHEBANGS",
+                flagSymbol: "shebang",
+                description: "Shebangs of files to search.",
+                target: &config.FileShebangs,
+            },
+            StringConfigOption {
+                name: "patternsToIgnore",
+                defaultValue: []string{".git", "venv", "node_modules", "bower_components", "*.png", "*.jpg", "*.jpeg", "*.pyc"},
+                envVariableName: "DEBOUNCE_GREP_PATTERNS_TO_IGNORE",
+                flagSymbol: "ignore",
+                description: "Glob patterns of files and directories to ignore.",
+                target: &config.PatternsToIgnore,
+            },
+            StringConfigOption {
+                name: "colors",
+                defaultValue: []string{},
+                envVariableName: "DEBOUNCE_GREP_COLORS",
+                flagSymbol: "color",
+                description: "Overrides of the theme's colors, as ROLE=COLOR. Roles are selected, marked, match, typing, positive, negative, scrollbar, lineno, keyword, string, comment and number, and colors are names of the 16 ANSI colors (red, bright-red, ...), 256-color numbers (208), #rrggbb or default.",
+                target: &config.Colors,
+            },
+            StringConfigOption {
+                name: "bindings",
+                defaultValue: []string{},
+                envVariableName: "DEBOUNCE_GREP_BINDINGS",
+                flagSymbol: "bind",
+                description: "Bindings of keys to actions for scrolling through, marking, copying and replacing matches, as KEY=ACTION. Keys are C-x, M-x, a char, pgup, pgdn, home, end, up, down, tab or C-space, and actions are page-down, page-up, half-page-down, half-page-up, first, last, next-file-with-matches, previous-file-with-matches, copy-path, copy-path-line, copy-line, toggle-mark, mark-all, invert-marks, replace, undo-replace or none to unbind a key. In the environmental variable bindings are separated by newlines, since actions can contain :.",
+                envVariableSeparator: "\n",
+                target: &config.Bindings,
+            },
+            StringConfigOption {
+                name: "commands",
+                defaultValue: []string{},
+                envVariableName: "DEBOUNCE_GREP_COMMANDS",
+                flagSymbol: "run",
+                description: "Bindings of keys to shell commands run on the selected or marked files, as KEY=COMMAND, with {path}, {line} and {term} replaced by the file's path, its best matching line and the search term. Output is shown in a pager, or the TUI is suspended while the command runs if it starts with !. In the environmental variable commands are separated by newlines, since they can contain :.",
+                envVariableSeparator: "\n",
+                target: &config.Commands,
+            },
         },
-        StringConfigOption {
-            name: "patternsToIgnore",
-            defaultValue: []string{".git", "venv", "node_modules", "bower_components", "*.png", "*.jpg", "*.jpeg", "*.pyc"},
-            envVariableName: "DEBOUNCE_GREP_PATTERNS_TO_IGNORE",
-            flagSymbol: "ignore",
-            flag: toIgnoreFlag,
-            description: "Glob patterns of files and directories to ignore.",
+        booleanOptions: []BooleanConfigOption {
+            BooleanConfigOption {
+                name: "shouldPrintWholeLines",
+                defaultValue: false,
+                envVariableName: "DEBOUNCE_GREP_SHOULD_PRINT_WHOLE_LINES",
+                flagSymbol: "whole-lines",
+                description: "If should print whole lines of matches as opposed to truncating them at end of tty.",
+                target: &config.ShouldPrintWholeLines,
+            },
+            BooleanConfigOption {
+                name: "isFuzzy",
+                defaultValue: false,
+                envVariableName: "DEBOUNCE_GREP_FUZZY",
+                flagSymbol: "fuzzy",
+                description: "If terms of queries should be matched fuzzily (fzf-style) as opposed to as substrings, with results ordered by how well they match.",
+                target: &config.IsFuzzy,
+            },
+            BooleanConfigOption {
+                name: "follow",
+                defaultValue: false,
+                envVariableName: "DEBOUNCE_GREP_FOLLOW",
+                flagSymbol: "follow",
+                description: "If the files searched should be followed like with tail -f, lines written to them that match the search term being added to the matches as they're written, and files that are truncated or rotated being searched again. Text piped to stdin is searched again as more of it comes in.",
+                target: &config.Follow,
+            },
+            BooleanConfigOption {
+                name: "searchArchives",
+                defaultValue: false,
+                envVariableName: "DEBOUNCE_GREP_ARCHIVES",
+                flagSymbol: "archives",
+                description: "If the members of zip and tar archives should be searched, listed as archive.zip!/path/of/member, as opposed to searching archives as a whole. Compressed files are always searched decompressed.",
+                target: &config.SearchArchives,
+            },
+            BooleanConfigOption {
+                name: "isSyntaxHighlighted",
+                defaultValue: false,
+                envVariableName: "DEBOUNCE_GREP_SYNTAX",
+                flagSymbol: "syntax",
+                description: "If matched lines and the preview should be highlighted by the syntax of their file type. Files over 1MB are never highlighted.",
+                target: &config.IsSyntaxHighlighted,
+            },
+            BooleanConfigOption {
+                name: "isMouseEnabled",
+                defaultValue: true,
+                envVariableName: "DEBOUNCE_GREP_MOUSE",
+                flagSymbol: "mouse",
+                description: "If clicks and the wheel should select, open and scroll through matches. Turning it off lets the terminal select text with the mouse.",
+                target: &config.IsMouseEnabled,
+            },
         },
-    }
-
-    booleanOptions = []BooleanConfigOption {
-        BooleanConfigOption {
-            name: "shouldPrintWholeLines",
-            defaultValue: false,
-            envVariableName: "DEBOUNCE_GREP_SHOULD_PRINT_WHOLE_LINES",
-            flagSymbol: "whole-lines",
-            description: "If should print whole lines of matches as opposed to truncating them at end of tty.",
+        choiceOptions: []ChoiceConfigOption {
+            ChoiceConfigOption {
+                name: "queryScope",
+                defaultValue: "file",
+                choices: []string{"file", "line"},
+                envVariableName: "DEBOUNCE_GREP_QUERY_SCOPE",
+                flagSymbol: "scope",
+                description: "Whether the terms of a query can match anywhere in a file (file) or all have to match on the same line (line).",
+                target: &config.QueryScope,
+            },
+            ChoiceConfigOption {
+                name: "sortMode",
+                defaultValue: "auto",
+                choices: []string{"auto", "path", "matches", "mtime", "relevance", "recent"},
+                envVariableName: "DEBOUNCE_GREP_SORT_MODE",
+                flagSymbol: "sort",
+                description: "Order of matched files: by path, number of matches, modification time (newest first), relevance to the query, or how recently they were opened, accepted, copied or run commands on (most recent first). auto is relevance for fuzzy queries and path otherwise.",
+                target: &config.SortMode,
+            },
+            ChoiceConfigOption {
+                name: "matchTarget",
+                defaultValue: "content",
+                choices: []string{"content", "path", "both"},
+                envVariableName: "DEBOUNCE_GREP_MATCH",
+                flagSymbol: "match",
+                description: "What queries are matched against: the contents of files, their paths (relative to the directory searched), or both.",
+                target: &config.MatchTarget,
+            },
+            ChoiceConfigOption {
+                name: "previewPosition",
+                defaultValue: "none",
+                choices: []string{"none", "right", "bottom"},
+                envVariableName: "DEBOUNCE_GREP_PREVIEW",
+                flagSymbol: "preview",
+                description: "Where to show a preview of the selected file, if at all.",
+                target: &config.PreviewPosition,
+            },
+            ChoiceConfigOption {
+                name: "theme",
+                defaultValue: "dark",
+                choices: []string{"dark", "light"},
+                envVariableName: "DEBOUNCE_GREP_THEME",
+                flagSymbol: "theme",
+                description: "Colors to render with, for terminals with dark or light backgrounds.",
+                target: &config.Theme,
+            },
+            ChoiceConfigOption {
+                name: "printFormat",
+                defaultValue: "path",
+                choices: []string{"path", "path-line"},
+                envVariableName: "DEBOUNCE_GREP_PRINT",
+                flagSymbol: "print",
+                description: "What's printed to stdout for the selected file when accepting it with enter: its path, or its path and the number of its best matching line (path:12).",
+                target: &config.PrintFormat,
+            },
         },
+        textOptions: []TextConfigOption {
+            TextConfigOption {
+                name: "clipboardCommand",
+                defaultValue: "",
+                envVariableName: "DEBOUNCE_GREP_CLIPBOARD_COMMAND",
+                flagSymbol: "clipboard-command",
+                description: "Command (run with sh -c) that paths and lines copied are piped to, e.g. \"xclip -selection clipboard\" or pbcopy, for terminals that don't support copying with OSC 52 escape codes.",
+                target: &config.ClipboardCommand,
+            },
+        },
+        setFlags: make(map[string]bool),
     }
+}
 
-    Options = ConfigOptions{
-        intOptions: intOptions,
-        stringOptions: stringOptions,
-        booleanOptions: booleanOptions,
+func parseEnviron(environ []string) map[string]string {
+    env := make(map[string]string)
+    for _, keyValue := range environ {
+        i := strings.Index(keyValue, "=")
+        if i < 0 {
+            continue
+        }
+        env[keyValue[:i]] = keyValue[i+1:]
     }
-
-    //map that will ultimately be used to access values of config options
-    Values = make(map[string]interface{})
-)
+    return env
+}
 
 
 
@@ -91,39 +348,93 @@ type ConfigOptions struct {
     intOptions []IntConfigOption
     stringOptions []StringConfigOption
     booleanOptions []BooleanConfigOption
+    choiceOptions []ChoiceConfigOption
+    textOptions []TextConfigOption
+    //symbols of flags that were passed on the command line, as opposed
+    //to flags whose values are just the defaults given to the flag package
+    setFlags map[string]bool
+    //environmental variables that options are read from
+    env map[string]string
 }
 
-func (configOptions *ConfigOptions) parseAndSaveValues() {
-    //need to define all flag parsers before calling flag.Parse()
-    configOptions.defineFlags()
-    flag.Parse()
+func (configOptions *ConfigOptions) parseAndSaveValues() error {
+    var errorMessages []string
     //loop these individually since they're slices of different types
-    for _, intOption := range configOptions.intOptions {
-        Values[intOption.name] = intOption.getValue()
+    for i, _ := range configOptions.intOptions {
+        intOption := &configOptions.intOptions[i]
+        value, err := intOption.getValue(configOptions)
+        if err != nil {
+            errorMessages = append(errorMessages, err.Error())
+            continue
+        }
+        *intOption.target = value
+    }
+    for i, _ := range configOptions.stringOptions {
+        stringOption := &configOptions.stringOptions[i]
+        *stringOption.target = stringOption.getValue(configOptions)
+    }
+    for i, _ := range configOptions.booleanOptions {
+        booleanOption := &configOptions.booleanOptions[i]
+        value, err := booleanOption.getValue(configOptions)
+        if err != nil {
+            errorMessages = append(errorMessages, err.Error())
+            continue
+        }
+        *booleanOption.target = value
     }
-    for _, stringOption := range configOptions.stringOptions {
-        Values[stringOption.name] = stringOption.getValue()
+    for i, _ := range configOptions.choiceOptions {
+        choiceOption := &configOptions.choiceOptions[i]
+        value, err := choiceOption.getValue(configOptions)
+        if err != nil {
+            errorMessages = append(errorMessages, err.Error())
+            continue
+        }
+        *choiceOption.target = value
     }
-    for _, booleanOption := range configOptions.booleanOptions {
-        Values[booleanOption.name] = booleanOption.getValue()
+    for i, _ := range configOptions.textOptions {
+        textOption := &configOptions.textOptions[i]
+        *textOption.target = textOption.getValue(configOptions)
     }
+    if len(errorMessages) > 0 {
+        return errors.New(strings.Join(errorMessages, "\n"))
+    }
+    return nil
 }
 
-func (configOptions *ConfigOptions) defineFlags() {
+func (configOptions *ConfigOptions) defineFlags(flagSet *flag.FlagSet) {
     var intOption *IntConfigOption
     for i, _ := range configOptions.intOptions {
         intOption = &configOptions.intOptions[i]
-        intOption.flagPointer = flag.Int(intOption.flagSymbol, intOption.defaultValue, intOption.description)
+        intOption.flagPointer = flagSet.Int(intOption.flagSymbol, intOption.defaultValue, intOption.description)
     }
     var stringOption *StringConfigOption
     for i, _ := range configOptions.stringOptions {
         stringOption = &configOptions.stringOptions[i]
-        flag.Var(&stringOption.flag, stringOption.flagSymbol, stringOption.description)
+        flagSet.Var(&stringOption.flag, stringOption.flagSymbol, stringOption.description)
     }
     var booleanOption *BooleanConfigOption
     for i, _ := range configOptions.booleanOptions {
         booleanOption = &configOptions.booleanOptions[i]
-        booleanOption.flagPointer = flag.Bool(booleanOption.flagSymbol, booleanOption.defaultValue, booleanOption.description)
+        booleanOption.flagPointer = flagSet.Bool(booleanOption.flagSymbol, booleanOption.defaultValue, booleanOption.description)
+    }
+    var choiceOption *ChoiceConfigOption
+    for i, _ := range configOptions.choiceOptions {
+        choiceOption = &configOptions.choiceOptions[i]
+        description := fmt.Sprintf("%v One of: %v.", choiceOption.description, strings.Join(choiceOption.choices, ", "))
+        choiceOption.flagPointer = flagSet.String(choiceOption.flagSymbol, choiceOption.defaultValue, description)
+    }
+    var textOption *TextConfigOption
+    for i, _ := range configOptions.textOptions {
+        textOption = &configOptions.textOptions[i]
+        textOption.flagPointer = flagSet.String(textOption.flagSymbol, textOption.defaultValue, textOption.description)
+    }
+}
+
+func (configOptions *ConfigOptions) setDefaultValue(name string, defaultValue []string) {
+    for i, _ := range configOptions.stringOptions {
+        if configOptions.stringOptions[i].name == name {
+            configOptions.stringOptions[i].defaultValue = defaultValue
+        }
     }
 }
 
@@ -134,25 +445,40 @@ type IntConfigOption struct {
     flagSymbol string
     description string
     flagPointer *int
+    //smallest value the option accepts, checked for flag and environmental
+    //variable values alike
+    minValue int
+    //field of Config the value is saved to
+    target *int
 }
 
-func (option *IntConfigOption) getValue() int {
+func (option *IntConfigOption) getValue(configOptions *ConfigOptions) (int, error) {
     //1) check flag
-    flagValue := *option.flagPointer
-    if flagValue > 0 {
+    if configOptions.setFlags[option.flagSymbol] {
+        flagValue := *option.flagPointer
         log.Printf("Value %v retrieved for config option %v from flag %v.", flagValue, option.name, option.flagSymbol)
-        return flagValue
+        return option.validate(flagValue, "flag -" + option.flagSymbol)
     }
     //2) check environmental variable
-    envVarValueString := os.Getenv(option.envVariableName)
+    envVarValueString := configOptions.env[option.envVariableName]
+    if len(envVarValueString) == 0 {
+        //3) return default if neither flag or environmental variable provided
+        log.Printf("No value provided for config option %v from flag or environmental variable, returning default value %v.", option.name, option.defaultValue)
+        return option.defaultValue, nil
+    }
     envVarValueInt, err := strconv.Atoi(envVarValueString)
     if err != nil {
-        //3) return default if neither flag or environmental variable provided
-        log.Printf("Either no value provided or value provided for config option %v from environmental variable %v could not be converted into int, returning default value %v.", option.name, option.envVariableName, option.defaultValue)
-        return option.defaultValue
+        return 0, fmt.Errorf("invalid value %q for environmental variable %v: must be an integer", envVarValueString, option.envVariableName)
     }
     log.Printf("Value %v retrieved for config option %v from environmental variable %v.", envVarValueInt, option.name, option.envVariableName)
-    return envVarValueInt
+    return option.validate(envVarValueInt, "environmental variable " + option.envVariableName)
+}
+
+func (option *IntConfigOption) validate(value int, source string) (int, error) {
+    if value < option.minValue {
+        return 0, fmt.Errorf("invalid value %v for %v: must be at least %v", value, source, option.minValue)
+    }
+    return value, nil
 }
 
 type StringConfigOption struct {
@@ -162,10 +488,13 @@ type StringConfigOption struct {
     flagSymbol string
     flag MultiValueFlag
     description string
-    flagPointer *string
+    //separates the values in the environmental variable, : if not set
+    envVariableSeparator string
+    //field of Config the value is saved to
+    target *[]string
 }
 
-func (option *StringConfigOption) getValue() []string {
+func (option *StringConfigOption) getValue(configOptions *ConfigOptions) []string {
     //1) check flag
     flagValue := option.flag
     if len(flagValue) > 0 {
@@ -173,13 +502,18 @@ func (option *StringConfigOption) getValue() []string {
         return flagValue
     }
     //2) check environmental variable
-    envValue := os.Getenv(option.envVariableName)
+    envValue := configOptions.env[option.envVariableName]
     if len (envValue) == 0 {
         //3) return default if neither flag or environmental variable provided
         log.Printf("No environmental variable for config option %v detected, returning default value of %v.", option.envVariableName, option.defaultValue)
         return option.defaultValue
     }
-    envVariableList := strings.Split(envValue, ":")
+    separator := option.envVariableSeparator
+    if separator == "" {
+        separator = ":"
+    }
+    //a trailing separator, as left by a heredoc, doesn't add an empty value
+    envVariableList := strings.Split(strings.Trim(envValue, separator), separator)
     log.Printf("Returning environmental variable value %v for %v config option.", envVariableList, option.envVariableName)
     return envVariableList
 }
@@ -204,27 +538,100 @@ type BooleanConfigOption struct {
     flagSymbol string
     description string
     flagPointer *bool
+    //field of Config the value is saved to
+    target *bool
+}
+
+func (option *BooleanConfigOption) getValue(configOptions *ConfigOptions) (bool, error) {
+    //1) check flag - can be passed as false (--whole-lines=false) to
+    //override a truthy environmental variable
+    if configOptions.setFlags[option.flagSymbol] {
+        flagValue := *option.flagPointer
+        log.Printf("Value %v retrieved for config option %v from flag %v.", flagValue, option.name, option.flagSymbol)
+        return flagValue, nil
+    }
+    //2) check environmental variable
+    envValueString := configOptions.env[option.envVariableName]
+    if len(envValueString) == 0 {
+        //3) return default if neither flag or environmental variable provided
+        log.Printf("No value provided for config option %v from flag or environmental variable, returning default value %v.", option.name, option.defaultValue)
+        return option.defaultValue, nil
+    }
+    envValue, err := strconv.ParseBool(envValueString)
+    if err != nil {
+        return false, fmt.Errorf("invalid value %q for environmental variable %v: must be a boolean", envValueString, option.envVariableName)
+    }
+    log.Printf("Value %v retrieved for config option %v from environmental variable %v.", envValue, option.name, option.envVariableName)
+    return envValue, nil
 }
 
-func (option *BooleanConfigOption) getValue() bool {
-    //because it doesn't seem that the default golang flag library
-    //can distinguish between default flags and no flags passed at
-    //all, all boolean flags will have to be specified as truthy:
-    //you won't be able to pass a boolean flag as false
-    flagValue := *option.flagPointer
-    if flagValue == false {
-        log.Printf("No truthy boolean retrieved for config option %v from flag %v.", option.name, option.flagSymbol)
-    } else {
-        log.Printf("Truthy value retrieved for config option %v from flag %v.", option.name, option.flagSymbol)
-        return true
-    }
-    envValueString := os.Getenv(option.envVariableName)
-    envValue, _ := strconv.ParseBool(envValueString)
+//for options that take a single value out of a set of choices
+type ChoiceConfigOption struct {
+    name string
+    defaultValue string
+    choices []string
+    envVariableName string
+    flagSymbol string
+    description string
+    flagPointer *string
+    //field of Config the value is saved to
+    target *string
+}
+
+func (option *ChoiceConfigOption) getValue(configOptions *ConfigOptions) (string, error) {
+    //1) check flag
+    if configOptions.setFlags[option.flagSymbol] {
+        flagValue := *option.flagPointer
+        log.Printf("Value %v retrieved for config option %v from flag %v.", flagValue, option.name, option.flagSymbol)
+        return option.validate(flagValue, "flag -" + option.flagSymbol)
+    }
+    //2) check environmental variable
+    envValue := configOptions.env[option.envVariableName]
+    if len(envValue) == 0 {
+        //3) return default if neither flag or environmental variable provided
+        log.Printf("No value provided for config option %v from flag or environmental variable, returning default value %v.", option.name, option.defaultValue)
+        return option.defaultValue, nil
+    }
     log.Printf("Value %v retrieved for config option %v from environmental variable %v.", envValue, option.name, option.envVariableName)
-    return envValue
+    return option.validate(envValue, "environmental variable " + option.envVariableName)
+}
+
+func (option *ChoiceConfigOption) validate(value string, source string) (string, error) {
+    for _, choice := range option.choices {
+        if value == choice {
+            return value, nil
+        }
+    }
+    return "", fmt.Errorf("invalid value %q for %v: must be one of %v", value, source, strings.Join(option.choices, ", "))
+}
+
+//for options that take a single value of any text, like a command
+type TextConfigOption struct {
+    name string
+    defaultValue string
+    envVariableName string
+    flagSymbol string
+    description string
+    flagPointer *string
+    //field of Config the value is saved to
+    target *string
 }
 
-func init(){
-    ut.SetUpLogging()
-    Options.parseAndSaveValues()
+func (option *TextConfigOption) getValue(configOptions *ConfigOptions) string {
+    //1) check flag - can be passed empty to override an environmental
+    //variable
+    if configOptions.setFlags[option.flagSymbol] {
+        flagValue := *option.flagPointer
+        log.Printf("Value %v retrieved for config option %v from flag %v.", flagValue, option.name, option.flagSymbol)
+        return flagValue
+    }
+    //2) check environmental variable
+    envValue := configOptions.env[option.envVariableName]
+    if len(envValue) == 0 {
+        //3) return default if neither flag or environmental variable provided
+        log.Printf("No value provided for config option %v from flag or environmental variable, returning default value %v.", option.name, option.defaultValue)
+        return option.defaultValue
+    }
+    log.Printf("Value %v retrieved for config option %v from environmental variable %v.", envValue, option.name, option.envVariableName)
+    return envValue
 }
@@ -0,0 +1,162 @@
+package config
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestNew(t *testing.T) {
+    tests := []struct {
+        name string
+        args []string
+        environ []string
+        //what's checked of the config, nil if New() should fail
+        get func(config *Config) interface{}
+        want interface{}
+        //in the error, if New() should fail
+        wantErr string
+    }{
+        {
+            name: "default",
+            get: func(config *Config) interface{} { return config.MaxLinesToPrintPerFile },
+            want: 5,
+        },
+        {
+            name: "negative flag",
+            args: []string{"-lines", "-1"},
+            wantErr: "invalid value -1 for flag -lines: must be at least 0",
+        },
+        {
+            name: "negative environmental variable",
+            environ: []string{"DEBOUNCE_GREP_MAX_LINES_PER_FILE=-1"},
+            wantErr: "invalid value -1 for environmental variable DEBOUNCE_GREP_MAX_LINES_PER_FILE",
+        },
+        {
+            name: "not an integer",
+            environ: []string{"DEBOUNCE_GREP_DEBOUNCE_TIME_MS=fast"},
+            wantErr: "must be an integer",
+        },
+        {
+            name: "flag set to 0",
+            args: []string{"-lines", "0"},
+            environ: []string{"DEBOUNCE_GREP_MAX_LINES_PER_FILE=3"},
+            get: func(config *Config) interface{} { return config.MaxLinesToPrintPerFile },
+            want: 0,
+        },
+        {
+            name: "choice not allowed",
+            args: []string{"--sort", "size"},
+            wantErr: "invalid value \"size\" for flag -sort: must be one of auto, path, matches, mtime, relevance, recent",
+        },
+        {
+            name: "choice not allowed in environmental variable",
+            environ: []string{"DEBOUNCE_GREP_QUERY_SCOPE=word"},
+            wantErr: "invalid value \"word\" for environmental variable DEBOUNCE_GREP_QUERY_SCOPE",
+        },
+        {
+            name: "flag overrides environmental variable",
+            args: []string{"--scope=line"},
+            environ: []string{"DEBOUNCE_GREP_QUERY_SCOPE=file"},
+            get: func(config *Config) interface{} { return config.QueryScope },
+            want: "line",
+        },
+        {
+            name: "environmental variable",
+            environ: []string{"DEBOUNCE_GREP_QUERY_SCOPE=line"},
+            get: func(config *Config) interface{} { return config.QueryScope },
+            want: "line",
+        },
+        {
+            name: "false flag overrides true environmental variable",
+            args: []string{"--whole-lines=false"},
+            environ: []string{"DEBOUNCE_GREP_SHOULD_PRINT_WHOLE_LINES=true"},
+            get: func(config *Config) interface{} { return config.ShouldPrintWholeLines },
+            want: false,
+        },
+        {
+            name: "true environmental variable",
+            environ: []string{"DEBOUNCE_GREP_SHOULD_PRINT_WHOLE_LINES=true"},
+            get: func(config *Config) interface{} { return config.ShouldPrintWholeLines },
+            want: true,
+        },
+        {
+            name: "not a boolean",
+            environ: []string{"DEBOUNCE_GREP_FUZZY=sometimes"},
+            wantErr: "must be a boolean",
+        },
+        {
+            name: "multiple values split on :",
+            environ: []string{"DEBOUNCE_GREP_PATTERNS_TO_IGNORE=.git:*.pyc:"},
+            get: func(config *Config) interface{} { return config.PatternsToIgnore },
+            want: []string{".git", "*.pyc"},
+        },
+        {
+            name: "multiple flags override environmental variable",
+            args: []string{"--ignore", "*.log", "--ignore", "tmp"},
+            environ: []string{"DEBOUNCE_GREP_PATTERNS_TO_IGNORE=.git:*.pyc"},
+            get: func(config *Config) interface{} { return config.PatternsToIgnore },
+            want: []string{"*.log", "tmp"},
+        },
+        {
+            name: "bindings split on newlines",
+            environ: []string{"DEBOUNCE_GREP_BINDINGS=C-n=page-down\nM-:=copy-line\n"},
+            get: func(config *Config) interface{} { return config.Bindings },
+            want: []string{"C-n=page-down", "M-:=copy-line"},
+        },
+        {
+            name: "commands split on newlines",
+            environ: []string{"DEBOUNCE_GREP_COMMANDS=C-o=!vim {path}:{line}\nC-g=git log -- {path}"},
+            get: func(config *Config) interface{} { return config.Commands },
+            want: []string{"C-o=!vim {path}:{line}", "C-g=git log -- {path}"},
+        },
+        {
+            name: "text flag set empty overrides environmental variable",
+            args: []string{"--clipboard-command="},
+            environ: []string{"DEBOUNCE_GREP_CLIPBOARD_COMMAND=pbcopy"},
+            get: func(config *Config) interface{} { return config.ClipboardCommand },
+            want: "",
+        },
+        {
+            name: "dirs to search from args",
+            args: []string{"--fuzzy", "/var/log", "/tmp"},
+            get: func(config *Config) interface{} { return config.DirsToSearch },
+            want: []string{"/var/log", "/tmp"},
+        },
+        {
+            name: "no color",
+            environ: []string{"NO_COLOR=1", "COLORTERM=truecolor"},
+            get: func(config *Config) interface{} { return []bool{config.IsColorDisabled, config.IsTrueColorSupported} },
+            want: []bool{true, true},
+        },
+    }
+    for _, test := range tests {
+        config, err := New(test.args, test.environ)
+        if test.wantErr != "" {
+            if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+                t.Errorf("%v: got error %v, want %q", test.name, err, test.wantErr)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%v: %v", test.name, err)
+            continue
+        }
+        if got := test.get(config); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("%v: got %#v, want %#v", test.name, got, test.want)
+        }
+    }
+}
+
+//every invalid value is reported, not just the first
+func TestNewReportsAllErrors(t *testing.T) {
+    _, err := New([]string{"-lines", "-1"}, []string{"DEBOUNCE_GREP_SORT_MODE=size"})
+    if err == nil {
+        t.Fatal("got no error")
+    }
+    for _, want := range []string{"-lines", "DEBOUNCE_GREP_SORT_MODE"} {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("got %q, want %v in it", err, want)
+        }
+    }
+}
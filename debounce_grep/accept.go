@@ -0,0 +1,63 @@
+package main
+
+import (
+    "fmt"
+    "log"
+)
+
+const (
+    //enter, with the tty set not to turn it into a line feed (C-j)
+    ENTER = 13
+    //C-g and escape quit without a selection
+    CTRL_G = 7
+    PRINT_PATH = "path"
+    PRINT_PATH_AND_LINE = "path-line"
+    //exit code when accepting without anything to print, like fzf's
+    NO_SELECTION_EXIT_CODE = 1
+)
+
+//Accepting (enter) quits and prints the selected file to stdout, or all of
+//the marked files if any are (see marks.go) - their paths, or their paths
+//and the numbers of their best matching lines (path:12), see
+//config.PrintFormat - so that the program can be used in shell
+//substitutions like vim $(debounce_grep). Quitting with C-g, escape or C-c
+//prints nothing and exits with CANCEL_EXIT_CODE.
+
+func (searchManager *SearchManager) accept() {
+    searchManager.saveQueryToHistory()
+    searchManager.isDone = true
+    files := searchManager.getFilesToActOn()
+    if len(files) == 0 {
+        log.Printf("Accepted without a selection.")
+        searchManager.exitCode = NO_SELECTION_EXIT_CODE
+        return
+    }
+    searchManager.recordUse(files)
+    for _, file := range files {
+        searchManager.output = append(searchManager.output, file.getOutputLine(searchManager.config.PrintFormat))
+    }
+    log.Printf("Accepted %v.", searchManager.output)
+}
+
+func (searchManager *SearchManager) cancel() {
+    log.Printf("Cancelled.")
+    searchManager.saveQueryToHistory()
+    searchManager.isDone = true
+    searchManager.exitCode = CANCEL_EXIT_CODE
+}
+
+//getOutputLine returns what's printed for file when it's accepted - for
+//stdin, which has no path, the text of its best matching line
+func (file *File) getOutputLine(printFormat string) string {
+    if file.source.IsVirtual() {
+        if lineWithMatches := file.getFirstLineWithMatches(); lineWithMatches != nil {
+            return lineWithMatches.text
+        }
+    }
+    if printFormat == PRINT_PATH_AND_LINE {
+        if lineWithMatches := file.getFirstLineWithMatches(); lineWithMatches != nil {
+            return fmt.Sprintf("%v:%v", file.path, lineWithMatches.lineNo)
+        }
+    }
+    return file.path
+}
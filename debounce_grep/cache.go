@@ -0,0 +1,167 @@
+package main
+
+import (
+    "log"
+    "time"
+
+    "debounce_grep/search"
+)
+
+//The matches of the last queries searched are cached so that typing doesn't
+//search all of filesToSearch on every keystroke: a query that was searched
+//before (as when backspacing) gets its cached matches, and a query that
+//narrows a cached one (see search.Query.Narrows(), as when a term is typed
+//further) only searches the files that matched it. An entry is dropped once
+//any of the files to search has been modified since it was searched - not
+//just the ones that matched, since a file edited to match has to be found.
+//That costs a stat of each file rather than a search of them, so it's
+//checked at most once per checkInterval (the debounce time) rather than on
+//every keystroke, and the cache is cleared when the files to search are
+//found again and have changed. Nothing is cached when piped stdin or files are followed, since
+//what's searched keeps growing.
+
+//number of queries whose matches are kept
+const QUERY_CACHE_SIZE = 32
+
+type QueryCacheEntry struct {
+    query *search.Query
+    //in the order they were searched in
+    filesWithMatches []File
+    searchedAt time.Time
+}
+
+type QueryCache struct {
+    //least recently used first
+    entries []*QueryCacheEntry
+    size int
+    checkInterval time.Duration
+    //when the files to search were last checked for being modified
+    checkedAt time.Time
+}
+
+func NewQueryCache(size int, checkInterval time.Duration) *QueryCache {
+    cache := &QueryCache{}
+    cache.size = size
+    cache.checkInterval = checkInterval
+    return cache
+}
+
+//get returns the cached matches of query among filesToSearch, ok being
+//false if they aren't cached or are out of date
+func (cache *QueryCache) get(query *search.Query, filesToSearch []search.File) ([]File, bool) {
+    cache.removeOutOfDate(filesToSearch)
+    for i, entry := range cache.entries {
+        if !isSameQuery(entry.query, query) {
+            continue
+        }
+        cache.use(i)
+        return entry.copyFilesWithMatches(), true
+    }
+    return nil, false
+}
+
+//getFilesToNarrow returns the files of filesToSearch that matched the
+//cached query with the fewest matches that query narrows, ok being false if
+//it narrows none
+func (cache *QueryCache) getFilesToNarrow(query *search.Query, filesToSearch []search.File) ([]search.File, bool) {
+    cache.removeOutOfDate(filesToSearch)
+    narrowestIndex := -1
+    for i, entry := range cache.entries {
+        if !query.Narrows(entry.query) {
+            continue
+        }
+        if narrowestIndex == -1 || len(entry.filesWithMatches) < len(cache.entries[narrowestIndex].filesWithMatches) {
+            narrowestIndex = i
+        }
+    }
+    if narrowestIndex == -1 {
+        return nil, false
+    }
+    entry := cache.entries[narrowestIndex]
+    cache.use(narrowestIndex)
+    files := make([]search.File, len(entry.filesWithMatches))
+    for i, file := range entry.filesWithMatches {
+        files[i] = file.source
+    }
+    log.Printf("Narrowing %q to the %v files that matched %q.", query.Text, len(files), entry.query.Text)
+    return files, true
+}
+
+//add caches filesWithMatches, in the order they were searched in, as the
+//matches of query searched at searchedAt
+func (cache *QueryCache) add(query *search.Query, filesWithMatches []File, searchedAt time.Time) {
+    for i, entry := range cache.entries {
+        if isSameQuery(entry.query, query) {
+            cache.remove(i)
+            break
+        }
+    }
+    entry := &QueryCacheEntry{query: query, searchedAt: searchedAt}
+    entry.filesWithMatches = make([]File, len(filesWithMatches))
+    copy(entry.filesWithMatches, filesWithMatches)
+    cache.entries = append(cache.entries, entry)
+    if len(cache.entries) > cache.size {
+        cache.remove(0)
+    }
+}
+
+func (cache *QueryCache) clear() {
+    cache.entries = nil
+}
+
+func (cache *QueryCache) remove(i int) {
+    cache.entries = append(cache.entries[:i], cache.entries[i+1:]...)
+}
+
+//use moves the entry at i to the end, as the most recently used
+func (cache *QueryCache) use(i int) {
+    entry := cache.entries[i]
+    cache.remove(i)
+    cache.entries = append(cache.entries, entry)
+}
+
+func isSameQuery(query *search.Query, otherQuery *search.Query) bool {
+    return query.Text == otherQuery.Text && query.Scope == otherQuery.Scope && query.Fuzzy == otherQuery.Fuzzy && query.Target == otherQuery.Target
+}
+
+//removeOutOfDate removes the entries searched before any of filesToSearch
+//was last modified, unless they were checked less than checkInterval ago
+func (cache *QueryCache) removeOutOfDate(filesToSearch []search.File) {
+    if len(cache.entries) == 0 || time.Since(cache.checkedAt) < cache.checkInterval {
+        return
+    }
+    cache.checkedAt = time.Now()
+    //each archive is stat'd once for all of its members
+    modTimeOfPath := make(map[string]time.Time)
+    var lastModTime time.Time
+    for _, file := range filesToSearch {
+        modTime, ok := modTimeOfPath[file.GetPathOnDisk()]
+        if !ok {
+            modTime = file.GetModTime()
+            modTimeOfPath[file.GetPathOnDisk()] = modTime
+        }
+        if modTime.After(lastModTime) {
+            lastModTime = modTime
+        }
+    }
+    for i := len(cache.entries) - 1; i >= 0; i-- {
+        entry := cache.entries[i]
+        //to the second, like search.File.IsModifiedSince()
+        if !lastModTime.Before(entry.searchedAt.Truncate(time.Second)) {
+            log.Printf("Files were modified since %q was searched.", entry.query.Text)
+            cache.remove(i)
+        }
+    }
+}
+
+//copyFilesWithMatches returns the files that matched, closed and not
+//selected like when they've just been searched
+func (entry *QueryCacheEntry) copyFilesWithMatches() []File {
+    filesWithMatches := make([]File, len(entry.filesWithMatches))
+    copy(filesWithMatches, entry.filesWithMatches)
+    for i := range filesWithMatches {
+        filesWithMatches[i].isOpen = false
+        filesWithMatches[i].isSelected = false
+    }
+    return filesWithMatches
+}
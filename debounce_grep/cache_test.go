@@ -0,0 +1,125 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "testing"
+    "time"
+
+    "debounce_grep/config"
+    "debounce_grep/internal/testfiles"
+    "debounce_grep/search"
+)
+
+//newTestSearchManager returns a search manager for the files under dir,
+//rendering to and logging nowhere until the test ends
+func newTestSearchManager(t testing.TB, dir string) *SearchManager {
+    shownScreen := screen
+    screen = NewScreen(ioutil.Discard, ttyHeight, ttyWidth)
+    log.SetOutput(ioutil.Discard)
+    t.Cleanup(func() {
+        screen = shownScreen
+        log.SetOutput(os.Stderr)
+    })
+    searchManager := &SearchManager{}
+    searchManager.config = &config.Config{QueryScope: string(search.FILE_SCOPE), MatchTarget: string(search.CONTENT_TARGET)}
+    for file := range search.Discover(context.Background(), search.Options{DirsToSearch: []string{dir}}) {
+        searchManager.filesToSearch = append(searchManager.filesToSearch, file)
+    }
+    searchManager.queryCache = NewQueryCache(QUERY_CACHE_SIZE, 0)
+    return searchManager
+}
+
+func getPaths(files []File) []string {
+    var paths []string
+    for _, file := range files {
+        paths = append(paths, filepath.Base(file.path))
+    }
+    sort.Strings(paths)
+    return paths
+}
+
+func TestQueryCache(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{"kafka.md": "kafka retention\n", "rabbit.md": "rabbit retention\n"})
+    searchManager := newTestSearchManager(t, dir)
+    steps := []struct {
+        searchTerm string
+        //written to rabbit.md before searching, if set
+        rabbit string
+        want []string
+    }{
+        {searchTerm: "retention", want: []string{"kafka.md", "rabbit.md"}},
+        //narrows the cached matches of retention
+        {searchTerm: "retention kafka", want: []string{"kafka.md"}},
+        //cached
+        {searchTerm: "retention", want: []string{"kafka.md", "rabbit.md"}},
+        //a file that didn't match is edited to match
+        {searchTerm: "retention kafka", rabbit: "rabbit retention, not kafka\n", want: []string{"kafka.md", "rabbit.md"}},
+        {searchTerm: "retention", rabbit: "rabbit\n", want: []string{"kafka.md"}},
+    }
+    for _, step := range steps {
+        if step.rabbit != "" {
+            testfiles.Write(t, dir, map[string]string{"rabbit.md": step.rabbit})
+            path := filepath.Join(dir, "rabbit.md")
+            //modification times can be kept to the second
+            modTime := time.Now().Add(2 * time.Second)
+            os.Chtimes(path, modTime, modTime)
+        }
+        got := getPaths(searchManager.getFilesWithMatches(step.searchTerm))
+        if !reflect.DeepEqual(got, step.want) {
+            t.Errorf("%q after writing %q to rabbit.md: got %q, want %q", step.searchTerm, step.rabbit, got, step.want)
+        }
+    }
+}
+
+//files aren't checked for being modified again until the check interval
+//has passed
+func TestQueryCacheCheckInterval(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{"rabbit.md": "rabbit retention\n"})
+    path := filepath.Join(dir, "rabbit.md")
+    //written well before it's searched
+    modTime := time.Now().Add(-time.Hour)
+    os.Chtimes(path, modTime, modTime)
+    searchManager := newTestSearchManager(t, dir)
+    searchManager.queryCache = NewQueryCache(QUERY_CACHE_SIZE, time.Hour)
+    searchManager.getFilesWithMatches("retention")
+    //checked now, with nothing modified
+    searchManager.getFilesWithMatches("rabbit")
+    testfiles.Write(t, dir, map[string]string{"rabbit.md": "rabbit\n"})
+    modTime = time.Now().Add(2 * time.Second)
+    os.Chtimes(path, modTime, modTime)
+    if got := getPaths(searchManager.getFilesWithMatches("retention")); !reflect.DeepEqual(got, []string{"rabbit.md"}) {
+        t.Errorf("got %q within the check interval, want the cached %q", got, []string{"rabbit.md"})
+    }
+    searchManager.queryCache.checkedAt = time.Time{}
+    if got := getPaths(searchManager.getFilesWithMatches("retention")); len(got) != 0 {
+        t.Errorf("got %q after the check interval, want none", got)
+    }
+}
+
+//BenchmarkTyping searches for each prefix of a query as it's typed, like a
+//debounceTimeMs of 0 does, with and without the query cache
+func BenchmarkTyping(b *testing.B) {
+    dir := testfiles.WriteFiles(b, testfiles.GetCorpus(500))
+    searchTerm := "kafka retention -rabbit"
+    for _, isCached := range []bool{true, false} {
+        b.Run(fmt.Sprintf("cached=%v", isCached), func(b *testing.B) {
+            searchManager := newTestSearchManager(b, dir)
+            for i := 0; i < b.N; i++ {
+                searchManager.queryCache = nil
+                if isCached {
+                    searchManager.queryCache = NewQueryCache(QUERY_CACHE_SIZE, 0)
+                }
+                for end := 1; end <= len(searchTerm); end++ {
+                    searchManager.getFilesWithMatches(searchTerm[:end])
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+    "encoding/base64"
+    "fmt"
+    "log"
+    "os/exec"
+    "strings"
+)
+
+const (
+    //OSC 52 sets the clipboard (c) to the base64 encoded text, even from
+    //across ssh, in terminals that support it
+    COPY_TO_CLIPBOARD_CODE = "\u001b]52;c;%s\u0007"
+)
+
+//copySelected copies the selected file's path, path:line or the text of
+//its line with the best match (the one the preview is centered on) to the
+//clipboard and says so in the status message. If files are marked, the
+//paths or lines of all of them are copied, one per line.
+func (searchManager *SearchManager) copySelected(action string) {
+    files := searchManager.getFilesToActOn()
+    if len(files) == 0 {
+        return
+    }
+    var texts []string
+    var description string
+    for _, file := range files {
+        lineWithMatches := file.getFirstLineWithMatches()
+        switch action {
+            case ACTION_COPY_PATH:
+                texts = append(texts, file.path)
+            case ACTION_COPY_PATH_AND_LINE:
+                texts = append(texts, file.getOutputLine(PRINT_PATH_AND_LINE))
+            case ACTION_COPY_LINE:
+                //matches only in the path have no line to copy
+                if lineWithMatches == nil {
+                    continue
+                }
+                texts = append(texts, lineWithMatches.text)
+                description = fmt.Sprintf("line %v", lineWithMatches.lineNo)
+        }
+    }
+    if len(texts) == 0 {
+        searchManager.statusMessage = "no line to copy"
+        return
+    }
+    if len(texts) > 1 && action == ACTION_COPY_LINE {
+        description = fmt.Sprintf("%v lines", len(texts))
+    } else if len(texts) > 1 {
+        description = fmt.Sprintf("%v paths", len(texts))
+    } else if action != ACTION_COPY_LINE {
+        description = texts[0]
+    }
+    text := strings.Join(texts, "\n")
+    if err := searchManager.copyToClipboard(text); err != nil {
+        log.Printf("Could not copy %q: %v", text, err)
+        searchManager.statusMessage = fmt.Sprintf("could not copy: %v", err)
+        return
+    }
+    searchManager.recordUse(files)
+    searchManager.statusMessage = "copied " + description
+}
+
+func (searchManager *SearchManager) copyToClipboard(text string) error {
+    fmt.Fprintf(screen, COPY_TO_CLIPBOARD_CODE, base64.StdEncoding.EncodeToString([]byte(text)))
+    clipboardCommand := searchManager.config.ClipboardCommand
+    if clipboardCommand == "" {
+        return nil
+    }
+    log.Printf("Piping %q to clipboard command %q.", text, clipboardCommand)
+    command := exec.Command("sh", "-c", clipboardCommand)
+    command.Stdin = strings.NewReader(text)
+    if output, err := command.CombinedOutput(); err != nil {
+        return fmt.Errorf("%v: %v", clipboardCommand, strings.TrimSpace(string(output)))
+    }
+    return nil
+}
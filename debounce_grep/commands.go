@@ -0,0 +1,258 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os/exec"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "debounce_grep/search"
+)
+
+const (
+    //commands starting with this are run with the TUI suspended instead of
+    //with their output shown in the pager
+    SUSPEND_COMMAND_PREFIX = "!"
+    PATH_PLACEHOLDER = "{path}"
+    LINE_PLACEHOLDER = "{line}"
+    TERM_PLACEHOLDER = "{term}"
+    //put before each command run in the pager, before its output
+    COMMAND_HEADER_PREFIX = "$ "
+    //how long the output of a command that's killed is waited for, in case
+    //processes it started are still writing to it
+    COMMAND_WAIT_DELAY = time.Second
+)
+
+//Commands are bound to keys with KEY=COMMAND (config.Commands), e.g.
+//--run "M-g=git log {path}" or --run "M-o=!vim +{line} {path}". {path},
+//{line} and {term} are replaced with the selected file's path, its best
+//matching line and the search term, quoted for the shell, and the command
+//is run with sh -c once for the selected file or for each marked file.
+//Commands' output is shown in the pager (see pager.go), except for ones
+//starting with ! which are run on the tty with the TUI suspended, for
+//editors and the like. Afterwards, files are found again and searched again
+//if any of them were added, removed or modified - after suspended commands
+//always, and after the others only if they modified or removed a file they
+//were run on, so that commands like git log don't walk every dir to search.
+//
+//Commands for the pager run in the background, their output being sent to
+//the loop in listenToStdinAndSearchFiles() once they exit, so that they can
+//be cancelled with C-g or escape while they run. They're killed after
+//config.CommandTimeoutSeconds too.
+
+//RunningCommand is a command run for the pager that hasn't exited yet
+type RunningCommand struct {
+    files []*File
+    startedAt time.Time
+    cancel context.CancelFunc
+}
+
+//getRunBindings parses KEY=COMMAND bindings into the keymap's form, where
+//commands are told apart from actions by RUN_ACTION_PREFIX
+func getRunBindings(commands []string) ([]string, error) {
+    var bindings []string
+    for _, command := range commands {
+        keyName, boundTo, ok := splitBinding(command)
+        if !ok {
+            return nil, fmt.Errorf("invalid command %q: has to be KEY=COMMAND", command)
+        }
+        bindings = append(bindings, keyName + "=" + RUN_ACTION_PREFIX + boundTo)
+    }
+    return bindings, nil
+}
+
+func quoteForShell(s string) string {
+    return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+//expandCommand returns command with the placeholders replaced for file
+func expandCommand(command string, file *File, searchTerm string) string {
+    lineNo := 1
+    if lineWithMatches := file.getFirstLineWithMatches(); lineWithMatches != nil {
+        lineNo = lineWithMatches.lineNo
+    }
+    replacer := strings.NewReplacer(
+        PATH_PLACEHOLDER, quoteForShell(file.path),
+        LINE_PLACEHOLDER, strconv.Itoa(lineNo),
+        TERM_PLACEHOLDER, quoteForShell(searchTerm),
+    )
+    return replacer.Replace(command)
+}
+
+//runCommand runs command on the files to act on, then refreshes the files
+//if the command could have changed any
+func (searchManager *SearchManager) runCommand(command string) {
+    files := searchManager.getFilesToActOn()
+    if len(files) == 0 {
+        searchManager.statusMessage = "no file to run on"
+        return
+    }
+    searchManager.recordUse(files)
+    if !strings.HasPrefix(command, SUSPEND_COMMAND_PREFIX) {
+        searchManager.startCommand(command, files)
+        return
+    }
+    failures := searchManager.runCommandSuspended(strings.TrimPrefix(command, SUSPEND_COMMAND_PREFIX), files)
+    //searching again clears the status message, so it's set after
+    searchManager.refreshFilesToSearch()
+    if len(failures) > 0 {
+        searchManager.statusMessage = "failed: " + strings.Join(failures, ", ")
+    }
+}
+
+//startCommand starts running command on each of files in the background
+//for the pager, see finishCommand()
+func (searchManager *SearchManager) startCommand(command string, files []*File) {
+    //expanded now, since the files can change while the commands run
+    var expandedCommands []string
+    for _, file := range files {
+        expandedCommands = append(expandedCommands, expandCommand(command, file, searchManager.searchTerm))
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    if searchManager.config.CommandTimeoutSeconds > 0 {
+        ctx, cancel = context.WithTimeout(context.Background(), time.Duration(searchManager.config.CommandTimeoutSeconds) * time.Second)
+    }
+    searchManager.runningCommand = &RunningCommand{files: files, startedAt: time.Now(), cancel: cancel}
+    searchManager.statusMessage = "running, C-g cancels"
+    go func() {
+        searchManager.commandOutputChannel <- getCommandOutput(ctx, expandedCommands)
+    }()
+}
+
+//cancelCommand kills the command that's running, whose output so far is
+//still shown once it has exited
+func (searchManager *SearchManager) cancelCommand() {
+    log.Printf("Cancelling the running command.")
+    searchManager.runningCommand.cancel()
+    searchManager.statusMessage = "cancelling"
+}
+
+//finishCommand shows the output of the command that was running, after
+//refreshing the files if it could have changed any
+func (searchManager *SearchManager) finishCommand(output []PagerLine) {
+    runningCommand := searchManager.runningCommand
+    searchManager.runningCommand = nil
+    runningCommand.cancel()
+    //searching again clears the status message, so the pager is opened
+    //after
+    if wereModifiedSince(runningCommand.files, runningCommand.startedAt) {
+        searchManager.refreshFilesToSearch()
+    }
+    searchManager.openPager(output)
+    searchManager.renderSearchTerm()
+    searchManager.renderSearchMatches()
+}
+
+//wereModifiedSince returns whether any of files has been modified or
+//removed since t
+func wereModifiedSince(files []*File, t time.Time) bool {
+    for _, file := range files {
+        if file.source.IsModifiedSince(t) {
+            log.Printf("%v was modified by the command.", file.path)
+            return true
+        }
+    }
+    return false
+}
+
+//runCommandSuspended runs command on the tty for each of files, with the
+//TUI and reading keys suspended until it exits, returning the files it
+//failed for
+func (searchManager *SearchManager) runCommandSuspended(command string, files []*File) []string {
+    isMouseEnabled := searchManager.config.IsMouseEnabled
+    pauseKeyboard()
+    atomic.StoreInt32(&isTerminalSuspended, 1)
+    restoreTerminal(isMouseEnabled)
+    var failures []string
+    for _, file := range files {
+        expandedCommand := expandCommand(command, file, searchManager.searchTerm)
+        log.Printf("Running %q with the TUI suspended.", expandedCommand)
+        cmd := exec.Command("sh", "-c", expandedCommand)
+        cmd.Stdin = getKeyboard()
+        cmd.Stdout = tty
+        cmd.Stderr = tty
+        if err := cmd.Run(); err != nil {
+            log.Printf("%q failed: %v", expandedCommand, err)
+            failures = append(failures, fmt.Sprintf("%v (%v)", file.path, err))
+        }
+    }
+    atomic.StoreInt32(&isTerminalSuspended, 0)
+    resumeTerminal(isMouseEnabled)
+    resumeKeyboard()
+    return failures
+}
+
+//getCommandOutput runs each of commands until ctx is done and returns the
+//lines they output for the pager, each after the command that output it
+func getCommandOutput(ctx context.Context, commands []string) []PagerLine {
+    var lines []PagerLine
+    for _, command := range commands {
+        header := COMMAND_HEADER_PREFIX + command
+        if ctx.Err() != nil {
+            lines = append(lines, PagerLine{text: header + fmt.Sprintf(" (not run, %v)", getCommandError(ctx, nil)), isHeader: true})
+            continue
+        }
+        log.Printf("Running %q for the pager.", command)
+        cmd := exec.CommandContext(ctx, "sh", "-c", command)
+        cmd.WaitDelay = COMMAND_WAIT_DELAY
+        output, err := cmd.CombinedOutput()
+        if err != nil {
+            log.Printf("%q failed: %v", command, err)
+            header += fmt.Sprintf(" (%v)", getCommandError(ctx, err))
+        }
+        lines = append(lines, PagerLine{text: header, isHeader: true})
+        for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+            lines = append(lines, PagerLine{text: line})
+        }
+    }
+    return lines
+}
+
+//getCommandError returns why a command failed, err being what running it
+//returned
+func getCommandError(ctx context.Context, err error) error {
+    if ctx.Err() == context.DeadlineExceeded {
+        return fmt.Errorf("timed out")
+    } else if ctx.Err() == context.Canceled {
+        return fmt.Errorf("cancelled")
+    }
+    return err
+}
+
+//refreshFilesToSearch finds the files to search again and searches them
+//again if any were added, removed or modified, keeping the same file
+//selected
+func (searchManager *SearchManager) refreshFilesToSearch() {
+    filesToSearch := searchManager.getFilesToSearch()
+    if !haveFilesChanged(searchManager.filesToSearch, filesToSearch) {
+        log.Printf("No files changed, not searching again.")
+        return
+    }
+    log.Printf("Files changed, searching again.")
+    searchManager.filesToSearch = filesToSearch
+    if searchManager.queryCache != nil {
+        searchManager.queryCache.clear()
+    }
+    searchManager.searchForMatchesKeepingSelection()
+}
+
+func haveFilesChanged(files []search.File, newFiles []search.File) bool {
+    if len(files) != len(newFiles) {
+        return true
+    }
+    fileOfPath := make(map[string]search.File)
+    for _, file := range files {
+        fileOfPath[file.Path] = file
+    }
+    for _, newFile := range newFiles {
+        file, ok := fileOfPath[newFile.Path]
+        if !ok || !file.ModTime.Equal(newFile.ModTime) || file.Size != newFile.Size {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+    "context"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestGetCommandOutput(t *testing.T) {
+    //output that looks like a header isn't one
+    output := getCommandOutput(context.Background(), []string{"echo a; echo '$ b'", "exit 1"})
+    want := []PagerLine{
+        {COMMAND_HEADER_PREFIX + "echo a; echo '$ b'", true},
+        {"a", false},
+        {"$ b", false},
+        {COMMAND_HEADER_PREFIX + "exit 1 (exit status 1)", true},
+        {"", false},
+    }
+    if !reflect.DeepEqual(output, want) {
+        t.Errorf("got %+v, want %+v", output, want)
+    }
+}
+
+//commands are killed once they time out or are cancelled, and those left
+//aren't run
+func TestGetCommandOutputStops(t *testing.T) {
+    timeOut := func() (context.Context, context.CancelFunc) {
+        return context.WithTimeout(context.Background(), 100 * time.Millisecond)
+    }
+    cancelLater := func() (context.Context, context.CancelFunc) {
+        ctx, cancel := context.WithCancel(context.Background())
+        time.AfterFunc(100 * time.Millisecond, cancel)
+        return ctx, cancel
+    }
+    tests := []struct {
+        name string
+        getContext func() (context.Context, context.CancelFunc)
+        want []PagerLine
+    }{
+        {"timed out", timeOut, []PagerLine{
+            {COMMAND_HEADER_PREFIX + "echo a; sleep 10 (timed out)", true},
+            {"a", false},
+            {COMMAND_HEADER_PREFIX + "echo b (not run, timed out)", true},
+        }},
+        {"cancelled", cancelLater, []PagerLine{
+            {COMMAND_HEADER_PREFIX + "echo a; sleep 10 (cancelled)", true},
+            {"a", false},
+            {COMMAND_HEADER_PREFIX + "echo b (not run, cancelled)", true},
+        }},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            ctx, cancel := test.getContext()
+            defer cancel()
+            startedAt := time.Now()
+            output := getCommandOutput(ctx, []string{"echo a; sleep 10", "echo b"})
+            if took := time.Since(startedAt); took > 5 * time.Second {
+                t.Errorf("took %v, want the command killed", took)
+            }
+            if !reflect.DeepEqual(output, test.want) {
+                t.Errorf("got %+v, want %+v", output, test.want)
+            }
+        })
+    }
+}
@@ -1,20 +1,24 @@
 package main
 
 import (
+    "context"
     "fmt"
     "strings"
     "time"
     "os"
-    "os/exec"
-    "path/filepath"
-    "bufio"
+    "os/signal"
     "sort"
-    "index/suffixarray"
-    "regexp"
     "log"
-    "github.com/mattn/go-zglob"
+    "flag"
+    "path/filepath"
+    "regexp"
+    "unicode/utf8"
     ut "debounce_grep/utilities"
     "debounce_grep/config"
+    "debounce_grep/history"
+    "debounce_grep/recent"
+    "debounce_grep/replace"
+    "debounce_grep/search"
 )
 
 
@@ -22,13 +26,8 @@ const (
     SPACE = " "
     LINE_BREAK = "\n"
     ELLIPSIS = "..."
-    //ANSI escape codes to control stdout and cursor in terminal
-    MAGENTA_COLOR_CODE = "\u001b[35m"
-    RED_COLOR_CODE = "\u001b[31m"
-    GREEN_COLOR_CODE = "\u001b[32m"
-    GREEN_BACKGROUND_COLOR_CODE = "\u001b[42m"
-    BLUE_COLOR_CODE = "\u001b[34m"
-    YELLOW_COLOR_CODE = "\u001b[33m"
+    //ANSI escape codes to control stdout and cursor in terminal - colors
+    //are in the theme, see theme.go
     CANCEL_COLOR_CODE = "\u001b[0m"
     CLEAR_LINE_CODE = "\033[K"
     NAVIGATE_CURSOR_CODE = "\033[%d;%dH" // passed line and column numbers
@@ -43,80 +42,66 @@ const (
     SCROLL_BAR_WIDTH = 1
 )
 
+//matches any ANSI escape code, to find the width text will be in the tty
+var ansiCodeRegexp = regexp.MustCompile("\x1b\\[[0-9;?]*[A-Za-z]")
+
 var (
-    ttyHeight, ttyWidth = ut.GetTtyDimensions()
+    //set by openTerminal()
+    ttyHeight, ttyWidth int
+    //width of and last line of the part of the tty matches are rendered in,
+    //which is smaller than the tty when the preview pane is shown - see
+    //updateLayout()
+    resultsWidth int
+    resultsLastLineNo int
     //space that is available for text of matches to be printed - 1 is for buffer before scroll bar
-    spaceForMatchText = ttyWidth - 1 - len(SEARCH_MATCH_SPACE_INDENT) - len(LINE_NO_BUFFER) - SCROLL_BAR_WIDTH
-    //see config package for description of config options
-    Config = config.Values
-    debounceTimeMs = Config["debounceTimeMs"].(int)
-    maxLinesToPrintPerFile = Config["maxLinesToPrintPerFile"].(int)
-    dirsToSearch = Config["dirsToSearch"].([]string)
-    fileShebangs = Config["fileShebangs"].([]string)
-    patternsToIgnore = Config["patternsToIgnore"].([]string)
-    shouldPrintWholeLines = Config["shouldPrintWholeLines"].(bool)
+    spaceForMatchText int
 )
 
 
 
 type File struct {
     path string
+    //file searched, for reading it again
+    source search.File
     linesWithMatches []LineWithMatches
+    //start and end offsets of matches of the query in path
+    pathMatchIndeces [][]int
     isSelected bool
+    isMarked bool
     isOpen bool
+    //best score of the file's lines for fuzzy queries
+    score int
+    relevance float64
+    modTime time.Time
+    //language for syntax highlighting, detected the first time it's needed
+    language *language
+    isLanguageDetected bool
 }
 
 func NewFile(filePath string, linesWithMatches []LineWithMatches) *File {
     file := &File{}
     file.path = filePath
+    file.linesWithMatches = linesWithMatches
     file.isSelected = false
     file.isOpen = false
     return file
 }
 
-func (file *File) hasShebang() bool{
-    if len(fileShebangs) == 0 {
-        return true
-    }
-    for line := range file.fileLinesGenerator(){
-        for _, shebang := range fileShebangs {
-            if line == shebang {
-                return true
-            }
-        }
-    }
-    return false
-}
-
-func (file *File) fileLinesGenerator() <- chan string {
-	ch := make(chan string)
-	go func() {
-        file, _ := os.Open(file.path)
-        defer file.Close()
-        scanner := bufio.NewScanner(file)
-        for scanner.Scan() {
-            ch <- scanner.Text()
-        }
-        close(ch)
-	}()
-	return ch
-}
-
-func (file *File) render() {
+func (file *File) render(config *config.Config) {
     file.renderFilePath()
     if file.isOpen {
-        file.open()
+        file.open(config.MaxLinesToPrintPerFile, config.ShouldPrintWholeLines, config.IsSyntaxHighlighted)
     }
 }
 
 func (file *File) renderFilePath() {
-    if file.isSelected {
-        fmt.Print(MAGENTA_COLOR_CODE)
+    if file.isMarked {
+        fmt.Fprint(screen, theme.markedFile + MARK_PREFIX + CANCEL_COLOR_CODE)
     }
-    var numberOfMatchesInFile int
-    for _, lineWithMatches := range file.linesWithMatches {
-        numberOfMatchesInFile += len(lineWithMatches.matchIndeces)
+    if file.isSelected {
+        fmt.Fprint(screen, theme.selectedFile)
     }
+    numberOfMatchesInFile := file.getNumberOfMatches()
 
     matchesString := "matches"
     if numberOfMatchesInFile == 1 {
@@ -128,51 +113,77 @@ func (file *File) renderFilePath() {
         linesString = "line"
     }
 
-    if file.isOpen {
-        fmt.Printf("%v - %v %v on %v %v", file.path, numberOfMatchesInFile, matchesString, len(file.linesWithMatches), linesString)
+    fmt.Fprint(screen, file.getPathWithColorCodes())
+    //matches in the path are counted apart from matches in the file's text
+    if numberOfMatchesInFile == 0 {
+        fmt.Fprint(screen, " - match in path")
+    } else if file.isOpen {
+        fmt.Fprintf(screen, " - %v %v on %v %v", numberOfMatchesInFile, matchesString, len(file.linesWithMatches), linesString)
     } else {
-        fmt.Printf("%v - %v %v", file.path, numberOfMatchesInFile, matchesString)
+        fmt.Fprintf(screen, " - %v %v", numberOfMatchesInFile, matchesString)
+    }
+    if numberOfMatchesInFile > 0 && len(file.pathMatchIndeces) > 0 {
+        fmt.Fprint(screen, ", match in path")
     }
     if file.isSelected {
-        fmt.Print(CANCEL_COLOR_CODE)
+        fmt.Fprint(screen, CANCEL_COLOR_CODE)
     }
 }
 
-func (file *File) open() {
-    //show matched lines in increasing order
+func (file *File) getPathWithColorCodes() string {
+    //highlight matches in the path, going back to the color of the rest of
+    //the path after each one
+    restOfPathColorCode := CANCEL_COLOR_CODE
+    if file.isSelected {
+        restOfPathColorCode = theme.selectedFile
+    }
+    var pathToRender string
+    previousMatchEndIndex := 0
+    for _, matchIndexPair := range file.pathMatchIndeces {
+        pathToRender += file.path[previousMatchEndIndex:matchIndexPair[0]]
+        pathToRender += theme.match + file.path[matchIndexPair[0]:matchIndexPair[1]] + CANCEL_COLOR_CODE
+        if file.isSelected {
+            pathToRender += restOfPathColorCode
+        }
+        previousMatchEndIndex = matchIndexPair[1]
+    }
+    pathToRender += file.path[previousMatchEndIndex:]
+    return pathToRender
+}
+
+func (file *File) getNumberOfMatches() int {
+    var numberOfMatchesInFile int
+    for _, lineWithMatches := range file.linesWithMatches {
+        numberOfMatchesInFile += len(lineWithMatches.matchIndeces)
+    }
+    return numberOfMatchesInFile
+}
+
+func (file *File) open(maxLinesToPrintPerFile int, shouldPrintWholeLines bool, isSyntaxHighlighted bool) {
+    //show best matching lines first for fuzzy queries, otherwise (when
+    //all scores are 0) matched lines in increasing order
     sort.Slice(file.linesWithMatches, func(i, j int) bool {
+        if file.linesWithMatches[i].score != file.linesWithMatches[j].score {
+            return file.linesWithMatches[i].score > file.linesWithMatches[j].score
+        }
         return file.linesWithMatches[i].lineNo < file.linesWithMatches[j].lineNo
     })
-    ut.PrintNewLine()
+    fmt.Fprint(screen, LINE_BREAK)
     numberOfLinesPrinted := 0
     for _, lineWithMatches := range file.linesWithMatches {
-        lineWithMatches.renderMatchedLine()
-        numberOfLinesPrinted += 1
-        if numberOfLinesPrinted == maxLinesToPrintPerFile {
+        //maxLinesToPrintPerFile of 0 means print all lines
+        if numberOfLinesPrinted == maxLinesToPrintPerFile && maxLinesToPrintPerFile > 0 {
             return
         }
+        lineWithMatches.syntaxColors = file.getSyntaxColorsOfLine(isSyntaxHighlighted, lineWithMatches.text)
+        lineWithMatches.renderMatchedLine(shouldPrintWholeLines)
+        numberOfLinesPrinted += 1
     } 
 }
 
-func (file *File) getLinesWithMatches(searchTerm string) []LineWithMatches {
-    var linesWithMatches []LineWithMatches
-    lineNumber := 1
-    for line := range file.fileLinesGenerator(){
-        if strings.Contains(line, searchTerm) {
-            searchTermRegex := regexp.MustCompile(searchTerm)
-            index := suffixarray.New([]byte(line))
-            matchIndeces := index.FindAllIndex(searchTermRegex, -1)
-            lineWithMatches := *NewLineWithMatches(lineNumber, matchIndeces, line)
-            linesWithMatches = append(linesWithMatches, lineWithMatches)
-        }
-        lineNumber ++
-    }
-    return linesWithMatches
-}
-
-func (file *File) getNumberOfLinesRendered() int {
+func (file *File) getNumberOfLinesRendered(maxLinesToPrintPerFile int) int {
     //2: one line for file path, one for space under matches
-    if len(file.linesWithMatches) > maxLinesToPrintPerFile {
+    if maxLinesToPrintPerFile > 0 && len(file.linesWithMatches) > maxLinesToPrintPerFile {
         return maxLinesToPrintPerFile + 2
     }
     return len(file.linesWithMatches) + 2
@@ -184,6 +195,9 @@ type LineWithMatches struct {
     matchIndeces [][]int
     text string
     wordsWithColorCodes []string
+    score int
+    //color code of each byte of text, nil if not syntax highlighted
+    syntaxColors []string
 }
 
 func NewLineWithMatches(lineNo int, matchIndeces [][]int, lineText string) *LineWithMatches {
@@ -194,36 +208,39 @@ func NewLineWithMatches(lineNo int, matchIndeces [][]int, lineText string) *Line
     return lineWithMatches
 }
 
-func (lineWithMatches *LineWithMatches) getMatchIndeces(indexOfIndeces int) (int, int) {
-    //not popping here since I don't want to mutate the state of matchIndeces since
-    //this method is called in more than one call of getWordsWithColorCodes
-    nextMatchIndexPair := lineWithMatches.matchIndeces[indexOfIndeces]
-    nextMatchStartIndex, nextMatchEndIndex := nextMatchIndexPair[0], nextMatchIndexPair[1]
-    return nextMatchStartIndex, nextMatchEndIndex
+func newLinesWithMatchesFromResult(result search.FileResult) []LineWithMatches {
+    linesWithMatches := make([]LineWithMatches, 0, len(result.LinesWithMatches))
+    for _, line := range result.LinesWithMatches {
+        lineWithMatches := NewLineWithMatches(line.LineNo, line.MatchIndeces, line.Text)
+        lineWithMatches.score = line.Score
+        linesWithMatches = append(linesWithMatches, *lineWithMatches)
+    }
+    return linesWithMatches
 }
 
 func (lineWithMatches *LineWithMatches) getWordsWithColorCodes() []string {
-    //insert color code and escape code around each match in line
-    var lineToRender string
-    nextMatchIndexPairIndex := 0 //index of a pair of indeces
-    nextMatchStartIndex, nextMatchEndIndex := lineWithMatches.getMatchIndeces(nextMatchIndexPairIndex)
+    //insert a color code wherever the color changes - matches are
+    //highlighted over syntax colors - and escape code where color ends
+    var lineToRender strings.Builder
+    currentColorCode := ""
+    matchIndexPairIndex := 0
     for charIndex, char := range lineWithMatches.text {
-        if charIndex == nextMatchStartIndex {
-            lineToRender = lineToRender + string(YELLOW_COLOR_CODE)
-        }
-        lineToRender = lineToRender + string(char)
-        if charIndex == nextMatchEndIndex - 1 {
-            lineToRender = lineToRender + string(CANCEL_COLOR_CODE)
-            if nextMatchIndexPairIndex < len(lineWithMatches.matchIndeces) - 1 {
-                nextMatchIndexPairIndex ++
-                nextMatchStartIndex, nextMatchEndIndex = lineWithMatches.getMatchIndeces(nextMatchIndexPairIndex)
-            } else {
-                nextMatchStartIndex = -1
-                nextMatchEndIndex = -1
+        colorCode := getCharColorCode(charIndex, lineWithMatches.matchIndeces, &matchIndexPairIndex, lineWithMatches.syntaxColors)
+        if colorCode != currentColorCode {
+            //cancel the color before setting another in case it's
+            //an attribute like bold that the next code wouldn't unset
+            if currentColorCode != "" {
+                lineToRender.WriteString(CANCEL_COLOR_CODE)
             }
+            lineToRender.WriteString(colorCode)
+            currentColorCode = colorCode
         }
+        lineToRender.WriteRune(char)
+    }
+    if currentColorCode != "" {
+        lineToRender.WriteString(CANCEL_COLOR_CODE)
     }
-    words := strings.Split(lineToRender, SPACE)
+    words := strings.Split(lineToRender.String(), SPACE)
     log.Printf("Returning words with color codes: \"%v\"", words)
     return words
 }
@@ -232,12 +249,14 @@ func (lineWithMatches *LineWithMatches) lineWillHitEndOfTty() {
 
 }
 
-func (lineWithMatches *LineWithMatches) renderMatchedLine() {
-    fmt.Print(SEARCH_MATCH_SPACE_INDENT)
-    fmt.Print(lineWithMatches.lineNo)
-    fmt.Print(SPACE)
-    lineWithMatches.renderMatchedLineText()
-    ut.PrintNewLine()
+func (lineWithMatches *LineWithMatches) renderMatchedLine(shouldPrintWholeLines bool) {
+    fmt.Fprint(screen, SEARCH_MATCH_SPACE_INDENT)
+    fmt.Fprint(screen, theme.lineNumber)
+    fmt.Fprint(screen, lineWithMatches.lineNo)
+    fmt.Fprint(screen, CANCEL_COLOR_CODE)
+    fmt.Fprint(screen, SPACE)
+    lineWithMatches.renderMatchedLineText(shouldPrintWholeLines)
+    fmt.Fprint(screen, LINE_BREAK)
 }
 
 func (lineWithMatches *LineWithMatches) removeSpacesOnEnds(entitiesToPrint []string) []string {
@@ -250,7 +269,7 @@ func (lineWithMatches *LineWithMatches) removeSpacesOnEnds(entitiesToPrint []str
     return entitiesToPrint
 }
 
-func (lineWithMatches *LineWithMatches) renderMatchedLineText() {
+func (lineWithMatches *LineWithMatches) renderMatchedLineText(shouldPrintWholeLines bool) {
     var entitiesToPrint []string
     words := lineWithMatches.getWordsWithColorCodes()
     if !shouldPrintWholeLines {
@@ -273,27 +292,29 @@ func (lineWithMatches *LineWithMatches) renderMatchedLineText() {
         entitiesToPrint = lineWithMatches.insertLineBreaksAndBuffers(words)
     }
     for _, entity := range entitiesToPrint {
-        fmt.Print(entity)
+        fmt.Fprint(screen, entity)
     }
+    //a truncated line can end in the middle of a colored string
+    fmt.Fprint(screen, CANCEL_COLOR_CODE)
 }
 
 func (lineWithMatches *LineWithMatches) getTruncatedLine(words []string) []string {
     //make sure first match will be in line and is in the middle of the line as possible
     //- find first matched word and alternate adding words to left and to right of match
+    //words are split on spaces, so the first matched word is after as many
+    //spaces as there are before the first match
     var firstMatchedWordIndex int
-    for wordIndex, word := range words {
-        if strings.Contains(word, CANCEL_COLOR_CODE) {
-            log.Printf("First match in line found to be index %v: \"%v\".", wordIndex, word)
-            firstMatchedWordIndex = wordIndex
-            break
-        }
+    if len(lineWithMatches.matchIndeces) > 0 {
+        firstMatchedWordIndex = strings.Count(lineWithMatches.text[:lineWithMatches.matchIndeces[0][0]], SPACE)
+        log.Printf("First match in line found to be index %v: \"%v\".", firstMatchedWordIndex, words[firstMatchedWordIndex])
     }
     firstMatchedWord := words[firstMatchedWordIndex]
     //if first matched word hits end of tty truncate it and return it with ellipsis
     if lineWithMatches.entityWillHitEndOfTty(firstMatchedWord, []string{ELLIPSIS}){
-        lengthOfTruncatedEntity := spaceForMatchText-len(ELLIPSIS) + len(YELLOW_COLOR_CODE) + len(CANCEL_COLOR_CODE)
-        singleTruncatedEntity := firstMatchedWord[:lengthOfTruncatedEntity]
-        return []string{singleTruncatedEntity, ELLIPSIS}
+        //space left of the preview pane can be narrow enough that not even
+        //the ellipsis fits
+        singleTruncatedEntity := truncateEntity(firstMatchedWord, spaceForMatchText - len(ELLIPSIS))
+        return []string{singleTruncatedEntity, CANCEL_COLOR_CODE, ELLIPSIS}
     }
     entitiesToPrint := []string{firstMatchedWord, ELLIPSIS}
     leftOfFirstMatchIndex := firstMatchedWordIndex - 1
@@ -394,39 +415,148 @@ func (lineWithMatches *LineWithMatches) entityWillHitEndOfTty(entity string, ent
 
 func (lineWithMatches *LineWithMatches) getLengthOfEntity(entity string) int {
     //don't include color codes in length of words
-    wordWithoutColorCodes := strings.Replace(entity, YELLOW_COLOR_CODE, "", 1)
-    wordWithoutColorCodes = strings.Replace(wordWithoutColorCodes, CANCEL_COLOR_CODE, "", 1)
-    lengthOfEntity := len(wordWithoutColorCodes)
+    wordWithoutColorCodes := ansiCodeRegexp.ReplaceAllString(entity, "")
+    lengthOfEntity := getStringWidth(wordWithoutColorCodes)
     return lengthOfEntity
 }
 
+//truncateEntity cuts entity off after width cells of the tty, not counting
+//color codes, keeping all of the codes before the cut
+func truncateEntity(entity string, width int) string {
+    var truncated strings.Builder
+    charsLeft := width
+    for len(entity) > 0 {
+        if codeIndeces := ansiCodeRegexp.FindStringIndex(entity); codeIndeces != nil && codeIndeces[0] == 0 {
+            truncated.WriteString(entity[:codeIndeces[1]])
+            entity = entity[codeIndeces[1]:]
+            continue
+        }
+        char, size := utf8.DecodeRuneInString(entity)
+        if getRuneWidth(char) > charsLeft {
+            break
+        }
+        truncated.WriteRune(char)
+        entity = entity[size:]
+        charsLeft -= getRuneWidth(char)
+    }
+    return truncated.String()
+}
+
 
 
 
 type SearchManager struct {
+    config *config.Config
     cursorIndex int
     searchTerm string
     searchState string
     selectedMatchIndex int
-    filesToSearch []File
+    filesToSearch []search.File
     filesWithMatches []File
     searchingMessageLastPrinted string
     timeLastPrintedSearchMessage int64
     matchIndexAtTopOfWindow int
     cursorLineNo int
     openFileIndexQueue []int
+    lastSearchedTerm string
+    //nil if the history is disabled
+    history *history.History
+    //index of the history entry being shown while going through the
+    //history with up/down, -1 when not going through it
+    historyIndex int
+    //what was typed before going through the history
+    historyDraft string
+    //query searched for last, until it's saved to the history (see
+    //saveQueryToHistory())
+    unsavedQuery string
+    isReverseSearching bool
+    reverseSearchQuery string
+    //index of history entry matching reverseSearchQuery, -1 if none does
+    reverseSearchIndex int
+    //one of the SORT_MODE_ constants
+    sortMode string
+    //shown on the right of the search term line until the next search
+    statusMessage string
+    //one of the PREVIEW_ constants
+    previewPosition string
+    //file shown in the preview and its lines
+    previewPath string
+    previewLines []string
+    //lines the preview is scrolled down from having the match centered
+    previewScrollOffset int
+    keymap Keymap
+    //paths of marked files, kept across searches
+    markedPaths map[string]bool
+    //output of commands shown in place of the matches, nil when the pager
+    //is closed
+    pagerLines []PagerLine
+    pagerScrollOffset int
+    //one of the REPLACE_STEP_ constants
+    replaceStep string
+    replacePattern string
+    replacement string
+    //changes being reviewed, the selected one and the first line of the
+    //review in the window
+    replaceChanges []ReplaceChange
+    replaceChangeIndex int
+    replaceScrollOffset int
+    replaceJournal *replace.Journal
+    //what's been read of stdin if it's piped, nil if it isn't
+    stdinBuffer *search.Buffer
+    //where each file followed was read up to, by path
+    tails map[string]*Tail
+    //when the dirs followed were last looked in for new files
+    newFilesLookedForAt time.Time
+    //matches of the last queries searched, nil when what's searched keeps
+    //growing
+    queryCache *QueryCache
+    //command being run for the pager, nil if none is, and where its output
+    //is sent once it exits
+    runningCommand *RunningCommand
+    commandOutputChannel chan []PagerLine
+    //when files were last used, for sorting by SORT_MODE_RECENT
+    recentFiles *recent.Recent
+    //set when accepting or cancelling, to quit with exitCode after
+    //printing output
+    isDone bool
+    exitCode int
+    output []string
 }
 
-func NewSearchManager() *SearchManager {
+func NewSearchManager(config *config.Config, keymap Keymap, stdinBuffer *search.Buffer) *SearchManager {
     searchManager := &SearchManager{}
+    searchManager.config = config
+    searchManager.stdinBuffer = stdinBuffer
+    searchManager.keymap = keymap
+    searchManager.markedPaths = make(map[string]bool)
+    searchManager.commandOutputChannel = make(chan []PagerLine, 1)
+    searchManager.replaceJournal = replace.NewJournal(filepath.Join(config.DataDir, replace.JOURNAL_FILE_NAME))
     searchManager.cursorIndex = 0
     searchManager.selectedMatchIndex = 0
     searchManager.searchTerm = ""
     searchManager.searchState = "TYPING"
     searchManager.filesToSearch = searchManager.getFilesToSearch()
+    searchManager.newFilesLookedForAt = time.Now()
     searchManager.searchingMessageLastPrinted = ""
     searchManager.timeLastPrintedSearchMessage = time.Now().UnixNano()
     searchManager.openFileIndexQueue = make([]int, 0)
+    searchManager.historyIndex = -1
+    searchManager.sortMode = config.SortMode
+    searchManager.previewPosition = config.PreviewPosition
+    searchManager.updateLayout()
+    if !config.Follow && stdinBuffer == nil {
+        searchManager.queryCache = NewQueryCache(QUERY_CACHE_SIZE, time.Duration(config.DebounceTimeMs) * time.Millisecond)
+    }
+    searchManager.recentFiles = recent.New(filepath.Join(config.DataDir, recent.RECENT_FILE_NAME), RECENT_FILES_SIZE)
+    if err := searchManager.recentFiles.Load(); err != nil {
+        log.Printf("Could not load recent files: %v", err)
+    }
+    if config.HistorySize > 0 {
+        searchManager.history = history.New(filepath.Join(config.DataDir, history.HISTORY_FILE_NAME), config.HistorySize)
+        if err := searchManager.history.Load(); err != nil {
+            log.Printf("Could not load history: %v", err)
+        }
+    }
     return searchManager
 }
 
@@ -450,51 +580,16 @@ func (searchManager *SearchManager) printSearchingMessage(searchMessageTemplate
     }
 }
 
-func (searchManager *SearchManager) getFilesToSearch() []File {
-    var toIgnore []string
-    var filesToSearch []File
-    for _, dirToSearch := range dirsToSearch {
+func (searchManager *SearchManager) getFilesToSearch() []search.File {
+    if searchManager.stdinBuffer != nil {
+        return []search.File{searchManager.getStdinFile()}
+    }
+    var filesToSearch []search.File
+    for _, dirToSearch := range searchManager.config.DirsToSearch {
         searchingMessage := fmt.Sprintf("Finding files to search in %v", dirToSearch)
-        err := filepath.Walk(dirToSearch, func(path string, info os.FileInfo, e error) error {
-            if e != nil {
-                return e
-            }
+        for file := range search.Discover(context.Background(), searchManager.getDiscoverOptions(dirToSearch)) {
             searchManager.printSearchingMessage(searchingMessage)
-            indexToRemove := -1
-            for toIgnoreIndex, toIgnorePath := range toIgnore {
-                if toIgnorePath == path {
-                    indexToRemove = toIgnoreIndex
-                    break
-                }
-            }
-            if indexToRemove > -1 {
-                //remove from toIgnore
-                toIgnore = append(toIgnore[:indexToRemove], toIgnore[indexToRemove+1:]...)
-                //skip dirs to ignore
-                if info.IsDir() {
-                    return filepath.SkipDir
-                }
-                //don't do anything with file to ignore
-            } else {
-                //search dir for dirs/files to ignore
-                if info.IsDir() {
-                    for _, patternToIgnore := range patternsToIgnore {
-                        toIgnoreMatches, _ := zglob.Glob(path + "/" + patternToIgnore)
-                        toIgnore = append(toIgnore, toIgnoreMatches...)
-                    }
-                //check file for shebang and add accordingly
-                } else {
-                    file := File{path: path}
-                    if file.hasShebang() {
-                        filesToSearch = append(filesToSearch, file)
-                    }
-                }
-
-            }
-            return nil
-        })
-        if err != nil {
-            fmt.Printf("error walking the path %q: %v\n", dirToSearch, err)
+            filesToSearch = append(filesToSearch, file)
         }
     }
     log.Printf("Retrieved %v files to search.", len(filesToSearch))
@@ -502,21 +597,67 @@ func (searchManager *SearchManager) getFilesToSearch() []File {
     return filesToSearch
 }
 
+func (searchManager *SearchManager) getDiscoverOptions(dirToSearch string) search.Options {
+    return search.Options{
+        DirsToSearch: []string{dirToSearch},
+        FileShebangs: searchManager.config.FileShebangs,
+        PatternsToIgnore: searchManager.config.PatternsToIgnore,
+        SearchArchives: searchManager.config.SearchArchives,
+    }
+}
+
 
 func (searchManager *SearchManager) printAtSearchTermLine(toPrint string) {
     searchManager.clearSearchMatchTerminalSpace()
-    fmt.Print(toPrint)
+    fmt.Fprint(screen, toPrint)
+    //searching doesn't return to the loop in listenToStdinAndSearchFiles()
+    //until it's done, so flush now for the message to be seen
+    screen.Flush()
+}
+
+//getQuery parses searchTerm into a query with the options in the config
+func (searchManager *SearchManager) getQuery(searchTerm string) (*search.Query, error) {
+    query, err := search.ParseQuery(searchTerm, search.Scope(searchManager.config.QueryScope))
+    if err != nil {
+        return nil, err
+    }
+    query.Fuzzy = searchManager.config.IsFuzzy
+    query.Target = search.Target(searchManager.config.MatchTarget)
+    return query, nil
 }
 
 func (searchManager *SearchManager) getFilesWithMatches(searchTerm string) []File {
     if len(searchManager.filesToSearch) > 0  && len(searchTerm) > 0 {
+        query, err := searchManager.getQuery(searchTerm)
+        if err != nil {
+            log.Printf("Could not parse query %q: %v", searchTerm, err)
+            return nil
+        }
+        filesToSearch := searchManager.filesToSearch
+        if searchManager.queryCache != nil {
+            if filesWithMatches, ok := searchManager.queryCache.get(query, filesToSearch); ok {
+                log.Printf("Using the cached matches of %q.", searchTerm)
+                return filesWithMatches
+            }
+            if narrowedFiles, ok := searchManager.queryCache.getFilesToNarrow(query, filesToSearch); ok {
+                filesToSearch = narrowedFiles
+            }
+        }
+        searchedAt := time.Now()
         var filesWithMatches []File
-        for i := 0; i < len(searchManager.filesToSearch); i++ {
+        searchManager.printSearchingMessage("Searching files")
+        for result := range search.Search(context.Background(), filesToSearch, query) {
             searchManager.printSearchingMessage("Searching files")
-            searchManager.filesToSearch[i].linesWithMatches = searchManager.filesToSearch[i].getLinesWithMatches(searchTerm)
-            if len(searchManager.filesToSearch[i].linesWithMatches) > 0 {
-                filesWithMatches = append(filesWithMatches, searchManager.filesToSearch[i])
-            }
+            file := NewFile(result.File.Path, newLinesWithMatchesFromResult(result))
+            file.source = result.File
+            file.pathMatchIndeces = result.PathMatchIndeces
+            file.score = result.Score
+            file.relevance = result.Relevance
+            file.modTime = result.File.ModTime
+            filesWithMatches = append(filesWithMatches, *file)
+        }
+        if searchManager.queryCache != nil {
+            searchManager.queryCache.add(query, filesWithMatches, searchedAt)
         }
         return filesWithMatches
     }
@@ -525,37 +666,109 @@ func (searchManager *SearchManager) getFilesWithMatches(searchTerm string) []Fil
 
 func (searchManager *SearchManager) listenToStdinAndSearchFiles() {
 
-    lastSearched := ""
     stdinChannel := make(chan []byte)
 
     go func(stdinChannel chan []byte) {
+        keyboard := getKeyboard()
         for {
-            exec.Command("stty", "-F", "/dev/tty", "cbreak", "min", "1").Run()
-            exec.Command("stty", "-F", "/dev/tty", "-echo").Run()
-            var b []byte = make([]byte, 1)
-            os.Stdin.Read(b)
-            stdinChannel <- b
+            //read more than a byte at a time so that escape sequences
+            //(like arrow keys) come in together
+            var b []byte = make([]byte, 64)
+            n, err := keyboard.Read(b)
+            if os.IsTimeout(err) {
+                //paused while a command reads keys, see pauseKeyboard()
+                <-resumeKeyboardChannel
+                continue
+            }
+            if err != nil {
+                break
+            }
+            stdinChannel <- b[:n]
         }
         close(stdinChannel)
     }(stdinChannel)
 
+    debounceTimeMs := searchManager.config.DebounceTimeMs
+    debounceTime := time.Duration(debounceTimeMs) * time.Millisecond
+
+    //the timer is started again by each stdin, and only by stdin, so that
+    //the search waits for debounceTimeMs without any keys. debounceChannel
+    //is nil while it isn't running - always with a debounceTimeMs of 0,
+    //which means search on every keystroke
+    debounceTimer := time.NewTimer(debounceTime)
+    debounceTimer.Stop()
+    defer debounceTimer.Stop()
+    var debounceChannel <-chan time.Time
+
+    //what's followed is checked for having grown on every tick, nil if
+    //nothing is followed
+    var followChannel <-chan time.Time
+    if searchManager.config.Follow {
+        followTicker := time.NewTicker(FOLLOW_INTERVAL_MS * time.Millisecond)
+        defer followTicker.Stop()
+        followChannel = followTicker.C
+    }
+
+    //the tty being resized is handled here like keys are, so that it isn't
+    //laid out again in the middle of rendering
+    resizeChannel := make(chan os.Signal, 1)
+    notifyOfResizes(resizeChannel)
+    defer signal.Stop(resizeChannel)
+
     stdinLoop:
     for {
         select {
             //stdin coming in
             case stdin, ok := <-stdinChannel:
                 if !ok {
+                    searchManager.cancel()
                     break stdinLoop
                 } else {
-                    searchManager.handleStdinCommands(stdin)
+                    for _, key := range splitKeys(stdin) {
+                        searchManager.handleStdinCommands(key)
+                        if searchManager.isDone {
+                            break stdinLoop
+                        }
+                    }
+                }
+                if debounceTimeMs == 0 {
+                    if searchManager.lastSearchedTerm != searchManager.searchTerm {
+                        searchManager.searchForMatches()
+                        searchManager.lastSearchedTerm = searchManager.searchTerm
+                    }
+                } else {
+                    //drained in case it fired but wasn't received yet,
+                    //without blocking as newer Go versions drain it on Stop
+                    if !debounceTimer.Stop() {
+                        select {
+                            case <-debounceTimer.C:
+                            default:
+                        }
+                    }
+                    debounceTimer.Reset(debounceTime)
+                    debounceChannel = debounceTimer.C
+                }
+            case <-resizeChannel:
+                searchManager.resize()
+            case output := <-searchManager.commandOutputChannel:
+                searchManager.finishCommand(output)
+            case <-followChannel:
+                if searchManager.stdinBuffer != nil {
+                    searchManager.searchGrownStdin()
+                } else {
+                    searchManager.followFiles()
                 }
             //debounceTimeMs has passed w/o any stdin
-            case <-time.After(time.Duration((1000000 * debounceTimeMs)) * time.Nanosecond):
-                if lastSearched != searchManager.searchTerm {
+            case <-debounceChannel:
+                debounceChannel = nil
+                if searchManager.lastSearchedTerm != searchManager.searchTerm {
                     searchManager.searchForMatches()
                 }
-                lastSearched = searchManager.searchTerm
+                searchManager.lastSearchedTerm = searchManager.searchTerm
         }
+        //whatever was rendered handling stdin or searching is written to
+        //the tty at once
+        screen.Flush()
     }
 }
 
@@ -563,8 +776,16 @@ func (searchManager *SearchManager) searchForMatches(){
     //clear queue of last opened files
     //searchManager.openFileIndexQueue = make([]int, 0)
     searchManager.openFileIndexQueue = nil
+    searchManager.statusMessage = ""
+    if searchManager.config.Follow {
+        searchManager.resetTails()
+    }
     searchManager.filesWithMatches = searchManager.getFilesWithMatches(searchManager.searchTerm)
+    if searchManager.config.Follow {
+        searchManager.keepNewestFollowedLines()
+    }
     log.Printf("%v matches found.", len(searchManager.filesWithMatches))
+    searchManager.setUnsavedQuery(searchManager.searchTerm)
     if len(searchManager.filesWithMatches) == 0 {
         searchManager.searchState = "NEGATIVE"
         searchManager.selectedMatchIndex = 0
@@ -572,43 +793,92 @@ func (searchManager *SearchManager) searchForMatches(){
         searchManager.searchState = "POSITIVE"
         searchManager.selectedMatchIndex = 0
     }
+    //a new search starts with the first file in the sort order selected
+    //and at the top of the window, rather than keeping a selection
+    searchManager.sortFiles()
     searchManager.matchIndexAtTopOfWindow = 0
-    searchManager.cursorLineNo = 2
+    searchManager.cursorLineNo = SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO
     searchManager.renderSearchTerm()
     searchManager.renderSearchMatches()
-    searchManager.renderScrollBar()
+}
+
+//searchForMatchesKeepingSelection searches for the search term again, for
+//when files changed, keeping the same file selected
+func (searchManager *SearchManager) searchForMatchesKeepingSelection() {
+    var selectedPath string
+    if searchManager.selectedMatchIndex < len(searchManager.filesWithMatches) {
+        selectedPath = searchManager.filesWithMatches[searchManager.selectedMatchIndex].path
+    }
+    searchManager.searchForMatches()
+    for i, file := range searchManager.filesWithMatches {
+        if file.path == selectedPath {
+            searchManager.selectMatch(i)
+            searchManager.renderSearchMatches()
+            break
+        }
+    }
 }
 
 func (searchManager *SearchManager) positionCursorAtIndex(){
+    if searchManager.isReverseSearching {
+        searchManager.navigateToLineAndColumn(SEARCH_TERM_TERMINAL_LINE_NO, searchManager.getReverseSearchCursorColumn())
+        return
+    }
+    if searchManager.replaceStep == REPLACE_STEP_PATTERN || searchManager.replaceStep == REPLACE_STEP_REPLACEMENT {
+        searchManager.navigateToLineAndColumn(SEARCH_TERM_TERMINAL_LINE_NO, len(searchManager.getReplacePrompt()) + 1)
+        return
+    }
     log.Printf("Positioning cursor at index at %vx%v.", SEARCH_TERM_TERMINAL_LINE_NO, searchManager.cursorIndex+1)
     searchManager.navigateToLineAndColumn(SEARCH_TERM_TERMINAL_LINE_NO, searchManager.cursorIndex+1)
 }
 
 func (searchManager *SearchManager) renderSearchTerm(){
+    if searchManager.isReverseSearching {
+        searchManager.renderReverseSearchPrompt()
+        return
+    }
+    if searchManager.replaceStep == REPLACE_STEP_PATTERN || searchManager.replaceStep == REPLACE_STEP_REPLACEMENT {
+        searchManager.renderReplacePrompt()
+        return
+    }
     var colorCode string
     if searchManager.searchState == "TYPING" {
-        colorCode = BLUE_COLOR_CODE
+        colorCode = theme.typing
     } else if searchManager.searchState == "POSITIVE" {
-        colorCode = GREEN_COLOR_CODE
+        colorCode = theme.positive
     } else if searchManager.searchState == "NEGATIVE" {
-        colorCode = RED_COLOR_CODE
+        colorCode = theme.negative
     }
     searchManager.clearTerminalLine(SEARCH_TERM_TERMINAL_LINE_NO)
     // no need to navigate to SEARCH_TERM_TERMINAL_LINE_NO
     // since cursor will be there after clearTerminalLine()
-    fmt.Print(colorCode)
-    fmt.Print(searchManager.searchTerm)
-    fmt.Print(CANCEL_COLOR_CODE)
+    fmt.Fprint(screen, colorCode)
+    fmt.Fprint(screen, searchManager.searchTerm)
+    fmt.Fprint(screen, CANCEL_COLOR_CODE)
+    searchManager.renderStatusMessage()
     searchManager.positionCursorAtIndex()
 }
 
+func (searchManager *SearchManager) renderStatusMessage(){
+    //right-aligned on the search term line, if it fits after the search term
+    if len(searchManager.statusMessage) == 0 {
+        return
+    }
+    column := ttyWidth - len(searchManager.statusMessage) - SCROLL_BAR_WIDTH
+    if column <= len(searchManager.searchTerm) + 1 {
+        return
+    }
+    searchManager.navigateToLineAndColumn(SEARCH_TERM_TERMINAL_LINE_NO, column)
+    fmt.Fprint(screen, searchManager.statusMessage)
+}
+
 func (searchManager *SearchManager) navigateToLineAndColumn(line int, column int){
-    fmt.Printf(NAVIGATE_CURSOR_CODE, line, column)
+    fmt.Fprintf(screen, NAVIGATE_CURSOR_CODE, line, column)
 }
 
 func (searchManager *SearchManager) clearTerminalLine(numberOfLineToClear int){
     searchManager.navigateToLineAndColumn(numberOfLineToClear, 1)
-    fmt.Printf(CLEAR_LINE_CODE)
+    fmt.Fprint(screen, CLEAR_LINE_CODE)
 }
 
 func (searchManager *SearchManager) clearSearchMatchTerminalSpace(){
@@ -624,95 +894,52 @@ func (searchManager *SearchManager) renderSearchMatches(){
     searchManager.clearSearchMatchTerminalSpace()
     searchManager.navigateToLineAndColumn(1, 1)
 
-    if len(searchManager.filesWithMatches) > 0 {
-
-        filesInWindowIndeces := make([]int, 0)
-        linesTakenUpByOpenFiles := 0
-        linesToSpareForMatches := ttyHeight - 1
-
-        //1) FIRST LOOP THROUGH OPENED FILES HITTING MOST RECENTLY OPENED FIRST
-        for i := len(searchManager.openFileIndexQueue)-1; i >= 0; i-- {
-            openFileIndex := searchManager.openFileIndexQueue[i]
-            openFile := searchManager.filesWithMatches[openFileIndex]
-            linesForFile := openFile.getNumberOfLinesRendered()
-            //if there's room for file
-            if linesToSpareForMatches - linesForFile >= 0 {
-                log.Printf("Adding open file %v to list of files to be printed.", searchManager.filesWithMatches[openFileIndex].path)
-                filesInWindowIndeces = append(filesInWindowIndeces, openFileIndex)
-                linesToSpareForMatches -= linesForFile
-                linesTakenUpByOpenFiles += linesForFile
-            } else {
-                //if only one file is open, then print it even though its
-                //hitting bottom of tty - user's combo of
-                //maxLinesToPrintPerFile and shouldPrintWholeLines
-                //is unfeasible
-                if len(searchManager.openFileIndexQueue) == 1 {
-                    filesInWindowIndeces = append(filesInWindowIndeces, openFileIndex)
-                    linesToSpareForMatches -= linesForFile
-                    linesTakenUpByOpenFiles += linesForFile
-                }
-            }
-        }
-        log.Printf("Open files taking up %v lines of tty space, %v lines left for closed files.", linesTakenUpByOpenFiles, linesToSpareForMatches)
-
-        //2) THEN FIND ALL THE CLOSED FILES YOU CAN SHOW IN ORDER OF FILE INDEX
-        top := searchManager.matchIndexAtTopOfWindow
-        bottom := searchManager.matchIndexAtTopOfWindow + ttyHeight - 1
-        for fileIndex := top; fileIndex <= bottom; fileIndex++ {
-            if len(searchManager.filesWithMatches) <= fileIndex {
-                //have reached end of matched files in the case that
-                //they're aren't enough matches files for scroll bar
-                break
-            } else if linesToSpareForMatches == 0 {
-                log.Printf("0 lines left for closed files.")
-                break
-            }
-            file := searchManager.filesWithMatches[fileIndex]
-            if !file.isOpen {
-                log.Printf("Adding closed file %v to list of files to be printed.", file.path)
-                filesInWindowIndeces = append(filesInWindowIndeces, fileIndex)
-                linesToSpareForMatches --
-            }
-        }
-
-        //3) SORT BY FILE INDEX AFTER FINDING BOTH OPEN AND CLOSED FILES
-        sort.Ints(filesInWindowIndeces)
+    if searchManager.isPagerOpen() {
+        searchManager.renderPager()
+        searchManager.positionCursorAtIndex()
+        return
+    }
+    if searchManager.replaceStep == REPLACE_STEP_REVIEW {
+        searchManager.renderReview()
+        searchManager.positionCursorAtIndex()
+        return
+    }
 
-        //4) THEN PRINT ALL THE FILES IN WINDOW INDECES
-        log.Printf("Indeces of files to be printed: %v", filesInWindowIndeces)
-        for _, fileIndex := range filesInWindowIndeces {
-            fileWithMatches := searchManager.filesWithMatches[fileIndex]
-            if fileIndex == searchManager.selectedMatchIndex {
-                fileWithMatches.isSelected = true
-            } else {
-                fileWithMatches.isSelected = false
-            }
-            ut.PrintNewLine()
-            fileWithMatches.render()
-        }
+    //render the files that fit in the window from matchIndexAtTopOfWindow
+    //on, in order - see Viewport
+    viewport := searchManager.getViewport()
+    lastVisibleIndex := viewport.getLastVisible()
+    log.Printf("Rendering matches %v to %v.", viewport.top, lastVisibleIndex)
+    for fileIndex := viewport.top; fileIndex <= lastVisibleIndex; fileIndex++ {
+        //pointer so that what's cached while rendering (e.g. the file's
+        //language) is kept
+        fileWithMatches := &searchManager.filesWithMatches[fileIndex]
+        fileWithMatches.isSelected = fileIndex == searchManager.selectedMatchIndex
+        fileWithMatches.isMarked = searchManager.isMarked(fileWithMatches.path)
+        fmt.Fprint(screen, LINE_BREAK)
+        fileWithMatches.render(searchManager.config)
     }
+    searchManager.renderScrollBar(viewport)
+    searchManager.renderPreview()
     searchManager.positionCursorAtIndex()
 }
 
-func (searchManager *SearchManager) renderScrollBar(){
-    if len(searchManager.filesWithMatches) < ttyHeight {
+func (searchManager *SearchManager) renderScrollBar(viewport *Viewport){
+    scrollBarStart, heightOfScrollBar := viewport.getScrollBar()
+    if heightOfScrollBar == 0 {
         log.Printf("100%% of matches shown in tty window, not rendering scroll bar.")
         return
     }
-    percentMatchesInWindow := float64(ttyHeight) / float64(len(searchManager.filesWithMatches))
-    heightOfScrollBar := ut.Round(percentMatchesInWindow * float64(ttyHeight))
-    log.Printf("Calculated scroll bar height to be %v lines (%.2f%% of tty height %v).", heightOfScrollBar, percentMatchesInWindow, ttyHeight)
-    scrollBarStartLine := int((float64(searchManager.matchIndexAtTopOfWindow) / float64(len(searchManager.filesWithMatches))) * float64(ttyHeight))
-    log.Printf("Caclulated scroll bar to start from %v.", scrollBarStartLine)
-    for i := scrollBarStartLine + 1; i <= scrollBarStartLine + heightOfScrollBar; i++ {
-        searchManager.navigateToLineAndColumn(i, ttyWidth)
-        fmt.Printf(GREEN_BACKGROUND_COLOR_CODE)
+    log.Printf("Calculated scroll bar to be %v lines starting from %v.", heightOfScrollBar, scrollBarStart)
+    firstLineNo := SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO + scrollBarStart
+    for lineNo := firstLineNo; lineNo < firstLineNo + heightOfScrollBar; lineNo++ {
+        searchManager.navigateToLineAndColumn(lineNo, resultsWidth)
+        fmt.Fprint(screen, theme.scrollBar)
         for i := 0; i < SCROLL_BAR_WIDTH; i++ {
-            fmt.Printf(" ")
+            fmt.Fprint(screen, " ")
         }
-        fmt.Printf(CANCEL_COLOR_CODE)
+        fmt.Fprint(screen, CANCEL_COLOR_CODE)
     }
-    searchManager.positionCursorAtIndex()
 }
 
 func (searchManager *SearchManager) incrementCursorIndex() {
@@ -736,31 +963,6 @@ func (searchManager *SearchManager) addCharToSearchTerm(char string) {
     searchManager.incrementCursorIndex()
 }
 
-func (searchManager *SearchManager) incrementSelectedMatchIndex() {
-    searchManager.selectedMatchIndex += 1
-    log.Printf("searchManager.selectedMatchIndex incremented to %v", searchManager.selectedMatchIndex)
-    log.Printf("cursorLineNo  %v and ttyHeight %v", searchManager.cursorLineNo , ttyHeight)
-    if searchManager.cursorLineNo == ttyHeight {
-        searchManager.matchIndexAtTopOfWindow += 1
-        log.Printf("searchManager.matchIndexAtTopOfWindow incremented to %v", searchManager.matchIndexAtTopOfWindow)
-    } else {
-        searchManager.cursorLineNo += 1
-        log.Printf("searchManager.cursorLineNo incremented to %v", searchManager.cursorLineNo)
-    }
-}
-
-func (searchManager *SearchManager) decrementSelectedMatchIndex() {
-    searchManager.selectedMatchIndex -= 1
-    log.Printf("searchManager.selectedMatchIndex decremented to  %v", searchManager.selectedMatchIndex)
-    log.Printf("cursorLineNo  %v and ttyHeight %v", searchManager.cursorLineNo , ttyHeight)
-    if searchManager.cursorLineNo == 2 {
-        searchManager.matchIndexAtTopOfWindow -= 1
-        log.Printf("DECREMENTING matchIndexAtTopOfWindow now at %v", searchManager.matchIndexAtTopOfWindow)
-    } else {
-        searchManager.cursorLineNo -= 1
-    }
-}
-
 func (searchManager *SearchManager) toggleIfMatchIsOpen(fileToToggleIndex int) {
     isNowOpen := !searchManager.filesWithMatches[fileToToggleIndex].isOpen
     searchManager.filesWithMatches[fileToToggleIndex].isOpen = isNowOpen
@@ -768,6 +970,7 @@ func (searchManager *SearchManager) toggleIfMatchIsOpen(fileToToggleIndex int) {
     if isNowOpen {
         //if file is now open, add file index to queue
         searchManager.openFileIndexQueue = append(searchManager.openFileIndexQueue, fileToToggleIndex)
+        searchManager.recordUse([]*File{&searchManager.filesWithMatches[fileToToggleIndex]})
     } else {
         //if file is now closed remove file index from queue
         for loopIndex, fileIndex := range searchManager.openFileIndexQueue {
@@ -780,14 +983,74 @@ func (searchManager *SearchManager) toggleIfMatchIsOpen(fileToToggleIndex int) {
 
 func (searchManager *SearchManager) handleStdinCommands(stdin []byte) {
 
-    if 32 <= stdin[0] && stdin[0] <= 126 { // char is alphanumeric or punctuation
+    //the files a command runs on are left as they are until it exits
+    if searchManager.runningCommand != nil {
+        if stdin[0] == CTRL_G || string(stdin) == string(rune(ESCAPE)) {
+            searchManager.cancelCommand()
+            searchManager.renderSearchTerm()
+        }
+        return
+    }
+
+    if searchManager.isReverseSearching && searchManager.handleReverseSearchCommands(stdin) {
+        return
+    }
+
+    if searchManager.isPagerOpen() {
+        searchManager.handlePagerCommands(stdin)
+        return
+    }
+
+    if searchManager.isReplacing() {
+        if _, ok := parseMouseEvent(stdin); !ok {
+            searchManager.handleReplaceCommands(stdin)
+        }
+        return
+    }
+
+    if mouseEvent, ok := parseMouseEvent(stdin); ok {
+        searchManager.saveQueryToHistory()
+        searchManager.handleMouseEvent(mouseEvent)
+        return
+    }
+
+    if action, ok := searchManager.keymap[string(stdin)]; ok {
+        searchManager.saveQueryToHistory()
+        searchManager.doAction(action)
+        return
+    }
+
+    if !isQueryEditingKey(stdin) {
+        searchManager.saveQueryToHistory()
+    }
+
+    if stdin[0] == ENTER {
+        searchManager.accept()
+        return
+    } else if stdin[0] == CTRL_G || string(stdin) == string(rune(ESCAPE)) {
+        searchManager.cancel()
+        return
+    }
+
+    if isUpKey(stdin) || stdin[0] == 16 { // up or C-p
+        searchManager.recallOlderQuery()
+
+    } else if isDownKey(stdin) || stdin[0] == 14 { // down or C-n
+        searchManager.recallNewerQuery()
+
+    } else if stdin[0] == 18 { // C-r
+        searchManager.startReverseSearch()
+
+    } else if 32 <= stdin[0] && stdin[0] <= 126 { // char is alphanumeric or punctuation
         searchManager.addCharToSearchTerm(string(stdin))
         searchManager.searchState = "TYPING"
+        searchManager.stopGoingThroughHistory()
 
     } else if stdin[0] == 4 { // C-d
         if searchManager.cursorIndex < len(searchManager.searchTerm) {
             searchManager.deleteCharForwards()
             searchManager.searchState = "TYPING"
+            searchManager.stopGoingThroughHistory()
         }
 
     } else if stdin[0] == 127 { // backspace
@@ -795,6 +1058,7 @@ func (searchManager *SearchManager) handleStdinCommands(stdin []byte) {
             searchManager.deleteCharBackwards()
             searchManager.decrementCursorIndex()
             searchManager.searchState = "TYPING"
+            searchManager.stopGoingThroughHistory()
         }
 
     } else if stdin[0] == 6 { // C-f
@@ -809,19 +1073,35 @@ func (searchManager *SearchManager) handleStdinCommands(stdin []byte) {
 
     } else if stdin[0] == 10 { // C-j
         if searchManager.selectedMatchIndex < len(searchManager.filesWithMatches) - 1 {
-            searchManager.incrementSelectedMatchIndex()
+            searchManager.selectNextMatch()
             searchManager.renderSearchMatches()
         }
 
     } else if stdin[0] == 11 { // C-k
         if searchManager.selectedMatchIndex > 0 {
-            searchManager.decrementSelectedMatchIndex()
+            searchManager.selectPreviousMatch()
             searchManager.renderSearchMatches()
         }
 
+    } else if stdin[0] == 15 { // C-o
+        searchManager.cycleSortMode()
+        searchManager.renderSearchMatches()
+
+    } else if stdin[0] == 20 { // C-t
+        searchManager.togglePreview()
+        searchManager.renderSearchMatches()
+
+    } else if stdin[0] == 5 { // C-e
+        searchManager.scrollPreview(1)
+
+    } else if stdin[0] == 25 { // C-y
+        searchManager.scrollPreview(-1)
+
     } else if stdin[0] == 0 { // C-space
         matchIndexToToggle := searchManager.selectedMatchIndex
         searchManager.toggleIfMatchIsOpen(matchIndexToToggle)
+        //the file's height changed, it may not all be in the window now
+        searchManager.selectMatch(matchIndexToToggle)
         searchManager.renderSearchMatches()
 
     } else {
@@ -829,15 +1109,50 @@ func (searchManager *SearchManager) handleStdinCommands(stdin []byte) {
         return
     }
     searchManager.renderSearchTerm()
-    searchManager.renderScrollBar()
-}
-
-func init() {
-    ut.SetUpLogging()
 }
 
 func main() {
+    //before anything is logged, so that nothing is logged to stderr
+    ut.SetUpLogging()
     log.Printf("STARTING MAIN DEBOUNCE_GREP PROGRAM.\n\n\n")
-    searchManager := NewSearchManager()
+    config, err := config.New(os.Args[1:], os.Environ())
+    if err == flag.ErrHelp {
+        os.Exit(0)
+    } else if err != nil {
+        fmt.Fprintf(os.Stderr, "debounce_grep: %v\n", err)
+        os.Exit(2)
+    }
+    theme, err = NewTheme(config.Theme, config.Colors, config.IsColorDisabled, config.IsTrueColorSupported)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "debounce_grep: %v\n", err)
+        os.Exit(2)
+    }
+    runBindings, err := getRunBindings(config.Commands)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "debounce_grep: %v\n", err)
+        os.Exit(2)
+    }
+    keymap, err := NewKeymap(append(config.Bindings, runBindings...))
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "debounce_grep: %v\n", err)
+        os.Exit(2)
+    }
+    openTerminal()
+    var stdinBuffer *search.Buffer
+    if isStdinPiped() {
+        if getKeyboard() == os.Stdin {
+            fmt.Fprintln(os.Stderr, "debounce_grep: can't read keys with stdin piped and no tty")
+            os.Exit(2)
+        }
+        stdinBuffer = search.NewBuffer()
+        go readStdin(stdinBuffer)
+    }
+    setUpTerminal(config.IsMouseEnabled)
+    searchManager := NewSearchManager(config, keymap, stdinBuffer)
     searchManager.listenToStdinAndSearchFiles()
+    restoreTerminal(config.IsMouseEnabled)
+    for _, line := range searchManager.output {
+        fmt.Println(line)
+    }
+    os.Exit(searchManager.exitCode)
 }
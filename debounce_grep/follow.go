@@ -0,0 +1,272 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "io"
+    "log"
+    "os"
+    "strings"
+    "time"
+
+    "debounce_grep/search"
+)
+
+//With config.Follow, the files searched are followed like with tail -f
+//(e.g. debounce_grep --follow /var/log/myapp): on every tick what's been
+//written to each file since it was searched is read, and the lines that
+//match the search term are added to the matches as they come in. Each
+//file keeps at most config.FollowMaxLines lines, the oldest being dropped,
+//from when it's searched on. A file that's truncated or rotated (renamed
+//with a new file created in its place) is searched again from the start.
+//Files created in the dirs followed are found every
+//FOLLOW_NEW_FILES_INTERVAL_MS and followed from their start, except for
+//compressed files and archives, which are only searched by the next search.
+//
+//New lines are matched on their own, so a file that didn't match has to
+//have all of the query on one new line to start matching, and new lines
+//with negated terms are left out rather than unmatching their file.
+
+//Tail is where a followed file was read up to
+type Tail struct {
+    info os.FileInfo
+    offset int64
+    //number of lines before offset, -1 until they're counted
+    lineNo int
+}
+
+//resetTails starts following each of filesToSearch from its end, before
+//it's searched. Lines written while it's searched are read again on the
+//next tick, and left out then as they've already been matched.
+func (searchManager *SearchManager) resetTails() {
+    searchManager.tails = make(map[string]*Tail)
+    if searchManager.stdinBuffer != nil {
+        return
+    }
+    for _, file := range searchManager.filesToSearch {
+        if file.IsArchiveMember() || file.IsVirtual() {
+            continue
+        }
+        info, err := os.Stat(file.Path)
+        if err != nil {
+            continue
+        }
+        searchManager.tails[file.Path] = &Tail{info: info, offset: info.Size(), lineNo: -1}
+    }
+}
+
+//followFiles adds the lines written to the files followed since the last
+//tick that match the search term to the matches
+func (searchManager *SearchManager) followFiles() {
+    if time.Since(searchManager.newFilesLookedForAt) >= FOLLOW_NEW_FILES_INTERVAL_MS * time.Millisecond {
+        searchManager.addNewFiles()
+    }
+    if len(searchManager.searchTerm) == 0 || len(searchManager.tails) == 0 {
+        return
+    }
+    query, err := searchManager.getQuery(searchManager.searchTerm)
+    if err != nil {
+        return
+    }
+    indexOfPath := make(map[string]int)
+    for i, file := range searchManager.filesWithMatches {
+        indexOfPath[file.path] = i
+    }
+    numberOfNewLines := 0
+    for i := range searchManager.filesToSearch {
+        fileToSearch := &searchManager.filesToSearch[i]
+        tail, ok := searchManager.tails[fileToSearch.Path]
+        if !ok {
+            continue
+        }
+        info, err := os.Stat(fileToSearch.Path)
+        if err != nil {
+            //rotated away with nothing created in its place yet
+            continue
+        }
+        if !os.SameFile(tail.info, info) || info.Size() < tail.offset {
+            log.Printf("%v was rotated or truncated, searching again.", fileToSearch.Path)
+            searchManager.searchForMatchesKeepingSelection()
+            return
+        }
+        if info.Size() == tail.offset {
+            continue
+        }
+        if tail.lineNo == -1 && fileToSearch.IsCompressed() {
+            //appending to compressed files isn't followed
+            delete(searchManager.tails, fileToSearch.Path)
+            continue
+        }
+        firstLineNo, lines, err := tail.readNewLines(fileToSearch.Path)
+        if err != nil {
+            log.Printf("Could not read what was written to %v: %v", fileToSearch.Path, err)
+            continue
+        }
+        tail.info = info
+        fileToSearch.ModTime = info.ModTime()
+        fileToSearch.Size = info.Size()
+        fileIndex, isFileMatched := indexOfPath[fileToSearch.Path]
+        lastLineNo := 0
+        if isFileMatched {
+            for _, lineWithMatches := range searchManager.filesWithMatches[fileIndex].linesWithMatches {
+                if lineWithMatches.lineNo > lastLineNo {
+                    lastLineNo = lineWithMatches.lineNo
+                }
+            }
+        }
+        var newLinesWithMatches []LineWithMatches
+        for j, line := range lines {
+            lineNo := firstLineNo + j
+            if lineNo <= lastLineNo {
+                continue
+            }
+            match, ok := query.MatchLine(lineNo, line, isFileMatched || len(newLinesWithMatches) > 0)
+            if !ok {
+                continue
+            }
+            lineWithMatches := NewLineWithMatches(match.LineNo, match.MatchIndeces, match.Text)
+            lineWithMatches.score = match.Score
+            newLinesWithMatches = append(newLinesWithMatches, *lineWithMatches)
+        }
+        if len(newLinesWithMatches) == 0 {
+            continue
+        }
+        numberOfNewLines += len(newLinesWithMatches)
+        if !isFileMatched {
+            file := NewFile(fileToSearch.Path, nil)
+            file.source = *fileToSearch
+            searchManager.filesWithMatches = append(searchManager.filesWithMatches, *file)
+            fileIndex = len(searchManager.filesWithMatches) - 1
+            indexOfPath[fileToSearch.Path] = fileIndex
+        }
+        searchManager.filesWithMatches[fileIndex].addFollowedLines(newLinesWithMatches, *fileToSearch, searchManager.config.FollowMaxLines)
+    }
+    if numberOfNewLines == 0 {
+        return
+    }
+    log.Printf("%v new lines matched in followed files.", numberOfNewLines)
+    searchManager.searchState = "POSITIVE"
+    searchManager.sortFilesWithMatches()
+    searchManager.renderSearchTerm()
+    searchManager.renderSearchMatches()
+}
+
+//addNewFiles adds the files created in the dirs followed since they were
+//last looked in to the files to search, following them from their start so
+//that what's in them is matched like lines written to followed files
+func (searchManager *SearchManager) addNewFiles() {
+    searchManager.newFilesLookedForAt = time.Now()
+    isSearched := make(map[string]bool)
+    for _, file := range searchManager.filesToSearch {
+        isSearched[file.Path + "!/" + file.MemberName] = true
+    }
+    numberOfNewFiles := 0
+    for _, dirToSearch := range searchManager.config.DirsToSearch {
+        for file := range search.Discover(context.Background(), searchManager.getDiscoverOptions(dirToSearch)) {
+            if isSearched[file.Path + "!/" + file.MemberName] {
+                continue
+            }
+            log.Printf("Found new file %v.", file.RelativePath())
+            searchManager.filesToSearch = append(searchManager.filesToSearch, file)
+            numberOfNewFiles ++
+            //nothing is followed until there's a search
+            if searchManager.tails == nil || file.IsArchiveMember() || file.IsCompressed() {
+                continue
+            }
+            info, err := os.Stat(file.Path)
+            if err != nil {
+                continue
+            }
+            searchManager.tails[file.Path] = &Tail{info: info, offset: 0, lineNo: 0}
+        }
+    }
+    if numberOfNewFiles > 0 {
+        log.Printf("%v new files to search.", numberOfNewFiles)
+    }
+}
+
+//keepNewestFollowedLines drops the oldest lines past config.FollowMaxLines
+//of each file matched by a search, like those added as they're written
+func (searchManager *SearchManager) keepNewestFollowedLines() {
+    for i := range searchManager.filesWithMatches {
+        searchManager.filesWithMatches[i].keepNewestLines(searchManager.config.FollowMaxLines)
+    }
+}
+
+//readNewLines returns the complete lines written to the file at path after
+//the tail and the number of the first of them, moving the tail past them.
+//A line still being written is left to be read once it ends.
+func (tail *Tail) readNewLines(path string) (int, []string, error) {
+    osFile, err := os.Open(path)
+    if err != nil {
+        return 0, nil, err
+    }
+    defer osFile.Close()
+    if tail.lineNo == -1 {
+        tail.lineNo, err = countLines(io.LimitReader(osFile, tail.offset))
+        if err != nil {
+            return 0, nil, err
+        }
+    }
+    if _, err := osFile.Seek(tail.offset, io.SeekStart); err != nil {
+        return 0, nil, err
+    }
+    var written bytes.Buffer
+    if _, err := written.ReadFrom(osFile); err != nil {
+        return 0, nil, err
+    }
+    end := bytes.LastIndexByte(written.Bytes(), '\n') + 1
+    if end == 0 {
+        return tail.lineNo + 1, nil, nil
+    }
+    var lines []string
+    for _, line := range strings.SplitAfter(string(written.Bytes()[:end]), "\n") {
+        if line != "" {
+            lines = append(lines, strings.TrimRight(line, "\r\n"))
+        }
+    }
+    firstLineNo := tail.lineNo + 1
+    tail.offset += int64(end)
+    tail.lineNo += len(lines)
+    return firstLineNo, lines, nil
+}
+
+//countLines returns the number of line breaks read from r
+func countLines(r io.Reader) (int, error) {
+    numberOfLines := 0
+    chunk := make([]byte, 32 * 1024)
+    for {
+        n, err := r.Read(chunk)
+        numberOfLines += bytes.Count(chunk[:n], []byte{'\n'})
+        if err == io.EOF {
+            return numberOfLines, nil
+        } else if err != nil {
+            return numberOfLines, err
+        }
+    }
+}
+
+//addFollowedLines adds lines that matched as they were written to the
+//file, dropping its oldest lines past maxLines
+func (file *File) addFollowedLines(linesWithMatches []LineWithMatches, source search.File, maxLines int) {
+    file.linesWithMatches = append(file.linesWithMatches, linesWithMatches...)
+    file.keepNewestLines(maxLines)
+    for _, lineWithMatches := range linesWithMatches {
+        if lineWithMatches.score > file.score {
+            file.score = lineWithMatches.score
+        }
+    }
+    file.source = source
+    file.modTime = source.ModTime
+}
+
+//keepNewestLines drops the file's oldest lines past maxLines
+func (file *File) keepNewestLines(maxLines int) {
+    if len(file.linesWithMatches) <= maxLines {
+        return
+    }
+    //copied so that the dropped lines can be freed
+    kept := make([]LineWithMatches, maxLines)
+    copy(kept, file.linesWithMatches[len(file.linesWithMatches) - maxLines:])
+    file.linesWithMatches = kept
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "debounce_grep/internal/testfiles"
+)
+
+func getLineNos(file File) []int {
+    var lineNos []int
+    for _, lineWithMatches := range file.linesWithMatches {
+        lineNos = append(lineNos, lineWithMatches.lineNo)
+    }
+    return lineNos
+}
+
+//a search keeps the newest lines of each file, like following does
+func TestSearchKeepsNewestFollowedLines(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{"app.log": strings.Repeat("kafka lag\n", 5)})
+    searchManager := newTestSearchManager(t, dir)
+    searchManager.queryCache = nil
+    searchManager.config.Follow = true
+    searchManager.config.FollowMaxLines = 2
+    searchManager.searchTerm = "kafka"
+    searchManager.searchForMatches()
+    if len(searchManager.filesWithMatches) != 1 {
+        t.Fatalf("got %v files with matches, want 1", len(searchManager.filesWithMatches))
+    }
+    if got := getLineNos(searchManager.filesWithMatches[0]); !reflect.DeepEqual(got, []int{4, 5}) {
+        t.Errorf("got lines %v, want %v", got, []int{4, 5})
+    }
+}
+
+//files created in the dirs followed are followed from their start
+func TestFollowNewFiles(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{"app.log": "kafka lag\n"})
+    searchManager := newTestSearchManager(t, dir)
+    searchManager.queryCache = nil
+    searchManager.config.Follow = true
+    searchManager.config.FollowMaxLines = 10
+    searchManager.config.DirsToSearch = []string{dir}
+    searchManager.searchTerm = "kafka"
+    searchManager.searchForMatches()
+    testfiles.Write(t, dir, map[string]string{"worker.log": "rabbit\nkafka offset\n"})
+    //not looked for until FOLLOW_NEW_FILES_INTERVAL_MS has passed
+    searchManager.newFilesLookedForAt = time.Now()
+    searchManager.followFiles()
+    if len(searchManager.filesWithMatches) != 1 {
+        t.Errorf("got %v files with matches before looking for new files, want 1", len(searchManager.filesWithMatches))
+    }
+    searchManager.newFilesLookedForAt = time.Time{}
+    searchManager.followFiles()
+    if got, want := getPaths(searchManager.filesWithMatches), []string{"app.log", "worker.log"}; !reflect.DeepEqual(got, want) {
+        t.Fatalf("got %q, want %q", got, want)
+    }
+    for _, file := range searchManager.filesWithMatches {
+        if filepath.Base(file.path) == "worker.log" && !reflect.DeepEqual(getLineNos(file), []int{2}) {
+            t.Errorf("got lines %v of worker.log, want %v", getLineNos(file), []int{2})
+        }
+    }
+    if len(searchManager.filesToSearch) != 2 {
+        t.Errorf("got %v files to search, want 2", len(searchManager.filesToSearch))
+    }
+}
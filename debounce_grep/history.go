@@ -0,0 +1,187 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "strings"
+)
+
+const (
+    REVERSE_SEARCH_PROMPT = "(reverse-i-search)`%v': %v"
+    FAILED_REVERSE_SEARCH_PROMPT = "(failed reverse-i-search)`%v': %v"
+)
+
+//A query that's been searched for is saved to the history once something
+//other than editing it is done - moving through or opening its matches,
+//running an action on them, accepting or quitting - so that what's
+//searched for while it's still being typed (kaf on the way to kafka) isn't
+//saved. Up/down (or C-p/C-n) go through the history and C-r searches
+//backwards through it the way shells do, and queries taken from the
+//history are searched for right away instead of waiting for the debounce
+//timer.
+
+//setUnsavedQuery makes query, which has just been searched for, the one
+//to save to the history once it's acted on
+func (searchManager *SearchManager) setUnsavedQuery(query string) {
+    //queries being gone through with up/down are already in the history
+    if searchManager.historyIndex != -1 {
+        searchManager.unsavedQuery = ""
+        return
+    }
+    searchManager.unsavedQuery = query
+}
+
+//saveQueryToHistory saves the query searched for last to the history if
+//it hasn't been saved yet
+func (searchManager *SearchManager) saveQueryToHistory() {
+    query := searchManager.unsavedQuery
+    if searchManager.history == nil || len(query) == 0 {
+        return
+    }
+    searchManager.unsavedQuery = ""
+    if err := searchManager.history.Add(query); err != nil {
+        log.Printf("Could not save query %q to history: %v", query, err)
+    }
+}
+
+//isQueryEditingKey returns whether key edits the search term or goes
+//through the history rather than acting on the matches
+func isQueryEditingKey(key []byte) bool {
+    if isUpKey(key) || isDownKey(key) {
+        return true
+    }
+    switch key[0] {
+        case 16, 14, 18, 4, 127, 6, 2: // C-p, C-n, C-r, C-d, backspace, C-f, C-b
+            return true
+    }
+    return 32 <= key[0] && key[0] <= 126
+}
+
+func (searchManager *SearchManager) searchForQueryFromHistory(query string) {
+    searchManager.searchTerm = query
+    searchManager.cursorIndex = len(query)
+    searchManager.searchForMatches()
+    searchManager.lastSearchedTerm = query
+}
+
+func (searchManager *SearchManager) stopGoingThroughHistory() {
+    searchManager.historyIndex = -1
+}
+
+func (searchManager *SearchManager) recallOlderQuery() {
+    if searchManager.history == nil {
+        return
+    }
+    entries := searchManager.history.Entries()
+    if searchManager.historyIndex == -1 {
+        if len(entries) == 0 {
+            return
+        }
+        searchManager.historyDraft = searchManager.searchTerm
+        searchManager.historyIndex = len(entries)
+    }
+    if searchManager.historyIndex > 0 {
+        searchManager.historyIndex --
+        log.Printf("Recalling query %v from history.", searchManager.historyIndex)
+        searchManager.searchForQueryFromHistory(entries[searchManager.historyIndex])
+    }
+}
+
+func (searchManager *SearchManager) recallNewerQuery() {
+    if searchManager.history == nil || searchManager.historyIndex == -1 {
+        return
+    }
+    entries := searchManager.history.Entries()
+    searchManager.historyIndex ++
+    if searchManager.historyIndex >= len(entries) {
+        //back to what was being typed before going through the history
+        searchManager.historyIndex = -1
+        searchManager.searchForQueryFromHistory(searchManager.historyDraft)
+        return
+    }
+    log.Printf("Recalling query %v from history.", searchManager.historyIndex)
+    searchManager.searchForQueryFromHistory(entries[searchManager.historyIndex])
+}
+
+func (searchManager *SearchManager) startReverseSearch() {
+    if searchManager.history == nil || len(searchManager.history.Entries()) == 0 {
+        return
+    }
+    searchManager.stopGoingThroughHistory()
+    searchManager.isReverseSearching = true
+    searchManager.reverseSearchQuery = ""
+    searchManager.reverseSearchIndex = len(searchManager.history.Entries()) - 1
+    searchManager.renderSearchTerm()
+}
+
+//handleReverseSearchCommands handles a key pressed while searching through
+//the history, returning false if the key should still be handled as it
+//normally would be - like in shells, keys that don't edit the reverse
+//search accept the query found and then do what they normally do
+func (searchManager *SearchManager) handleReverseSearchCommands(stdin []byte) bool {
+    entries := searchManager.history.Entries()
+    isHandled := true
+    if len(stdin) == 1 && 32 <= stdin[0] && stdin[0] <= 126 {
+        searchManager.reverseSearchQuery += string(stdin)
+        if searchManager.reverseSearchIndex != -1 {
+            searchManager.reverseSearchIndex = searchManager.history.SearchBackwards(searchManager.reverseSearchQuery, searchManager.reverseSearchIndex)
+        }
+
+    } else if stdin[0] == 127 { // backspace
+        if len(searchManager.reverseSearchQuery) > 0 {
+            searchManager.reverseSearchQuery = searchManager.reverseSearchQuery[:len(searchManager.reverseSearchQuery)-1]
+            searchManager.reverseSearchIndex = searchManager.history.SearchBackwards(searchManager.reverseSearchQuery, len(entries)-1)
+        }
+
+    } else if stdin[0] == 18 { // C-r
+        if searchManager.reverseSearchIndex > 0 {
+            olderIndex := searchManager.history.SearchBackwards(searchManager.reverseSearchQuery, searchManager.reverseSearchIndex-1)
+            if olderIndex != -1 {
+                searchManager.reverseSearchIndex = olderIndex
+            }
+        }
+
+    } else if stdin[0] == 7 { // C-g
+        searchManager.isReverseSearching = false
+
+    } else {
+        searchManager.acceptReverseSearch()
+        //enter, C-j and escape only accept
+        isHandled = stdin[0] == ENTER || stdin[0] == 10 || string(stdin) == string([]byte{ESCAPE})
+    }
+    searchManager.renderSearchTerm()
+    return isHandled
+}
+
+func (searchManager *SearchManager) acceptReverseSearch() {
+    searchManager.isReverseSearching = false
+    if searchManager.reverseSearchIndex == -1 {
+        return
+    }
+    query := searchManager.history.Entries()[searchManager.reverseSearchIndex]
+    log.Printf("Accepting query %q from reverse search of history.", query)
+    searchManager.searchForQueryFromHistory(query)
+}
+
+func (searchManager *SearchManager) getReverseSearchPrompt() string {
+    if searchManager.reverseSearchIndex == -1 {
+        return fmt.Sprintf(FAILED_REVERSE_SEARCH_PROMPT, searchManager.reverseSearchQuery, "")
+    }
+    match := searchManager.history.Entries()[searchManager.reverseSearchIndex]
+    return fmt.Sprintf(REVERSE_SEARCH_PROMPT, searchManager.reverseSearchQuery, match)
+}
+
+func (searchManager *SearchManager) renderReverseSearchPrompt() {
+    searchManager.clearTerminalLine(SEARCH_TERM_TERMINAL_LINE_NO)
+    fmt.Fprint(screen, searchManager.getReverseSearchPrompt())
+    searchManager.positionCursorAtIndex()
+}
+
+//column the cursor is at in the reverse search prompt, right after the query
+func (searchManager *SearchManager) getReverseSearchCursorColumn() int {
+    prompt := FAILED_REVERSE_SEARCH_PROMPT
+    if searchManager.reverseSearchIndex != -1 {
+        prompt = REVERSE_SEARCH_PROMPT
+    }
+    return strings.Index(prompt, "%v") + len(searchManager.reverseSearchQuery) + 1
+}
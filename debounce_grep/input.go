@@ -0,0 +1,102 @@
+package main
+
+import (
+    "fmt"
+)
+
+const (
+    ESCAPE = 27
+    //escape sequences sent by the arrow keys, in both the normal and
+    //application cursor key modes terminals can be in
+    UP_ARROW_KEY = "\u001b[A"
+    DOWN_ARROW_KEY = "\u001b[B"
+    UP_ARROW_KEY_APPLICATION_MODE = "\u001bOA"
+    DOWN_ARROW_KEY_APPLICATION_MODE = "\u001bOB"
+    //SGR mouse events are reported as ESC[<button;column;lineM, ending in m
+    //instead when a button is released
+    MOUSE_EVENT_PREFIX = "\u001b[<"
+    MOUSE_LEFT_BUTTON = 0
+    MOUSE_WHEEL_UP = 64
+    MOUSE_WHEEL_DOWN = 65
+    //bits set in the button of events with shift, meta or control held
+    MOUSE_MODIFIER_BITS = 4 | 8 | 16
+)
+
+//splitKeys splits what was read from stdin in one read into individual key
+//presses: escape sequences (arrow keys etc.) are kept together as one key
+//and everything else is one byte per key
+func splitKeys(stdin []byte) [][]byte {
+    var keys [][]byte
+    for i := 0; i < len(stdin); {
+        keyLength := 1
+        if stdin[i] == ESCAPE {
+            keyLength = getEscapeSequenceLength(stdin[i:])
+        }
+        keys = append(keys, stdin[i:i+keyLength])
+        i += keyLength
+    }
+    return keys
+}
+
+func getEscapeSequenceLength(stdin []byte) int {
+    if len(stdin) < 2 {
+        //just the escape key
+        return 1
+    }
+    switch stdin[1] {
+        case '[':
+            //CSI sequence: parameters and intermediates until a final byte
+            //in the range @ to ~
+            for i := 2; i < len(stdin); i++ {
+                if '@' <= stdin[i] && stdin[i] <= '~' {
+                    return i + 1
+                }
+            }
+            return len(stdin)
+        case 'O':
+            //SS3 sequence: one more byte
+            if len(stdin) < 3 {
+                return len(stdin)
+            }
+            return 3
+        default:
+            //meta/alt + key
+            return 2
+    }
+}
+
+func isUpKey(key []byte) bool {
+    return string(key) == UP_ARROW_KEY || string(key) == UP_ARROW_KEY_APPLICATION_MODE
+}
+
+func isDownKey(key []byte) bool {
+    return string(key) == DOWN_ARROW_KEY || string(key) == DOWN_ARROW_KEY_APPLICATION_MODE
+}
+
+type MouseEvent struct {
+    //one of the MOUSE_ constants, without modifiers
+    button int
+    lineNo int
+    column int
+    isRelease bool
+}
+
+//parseMouseEvent parses key as an SGR mouse event, ok being false if it
+//isn't one
+func parseMouseEvent(key []byte) (event MouseEvent, ok bool) {
+    if len(key) < len(MOUSE_EVENT_PREFIX) + 1 || string(key[:len(MOUSE_EVENT_PREFIX)]) != MOUSE_EVENT_PREFIX {
+        return event, false
+    }
+    final := key[len(key)-1]
+    if final != 'M' && final != 'm' {
+        return event, false
+    }
+    params := string(key[len(MOUSE_EVENT_PREFIX):len(key)-1])
+    var button int
+    if _, err := fmt.Sscanf(params, "%d;%d;%d", &button, &event.column, &event.lineNo); err != nil {
+        return event, false
+    }
+    event.button = button &^ MOUSE_MODIFIER_BITS
+    event.isRelease = final == 'm'
+    return event, true
+}
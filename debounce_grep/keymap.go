@@ -0,0 +1,195 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "strings"
+)
+
+const (
+    ACTION_PAGE_DOWN = "page-down"
+    ACTION_PAGE_UP = "page-up"
+    ACTION_HALF_PAGE_DOWN = "half-page-down"
+    ACTION_HALF_PAGE_UP = "half-page-up"
+    ACTION_FIRST = "first"
+    ACTION_LAST = "last"
+    ACTION_NEXT_FILE_WITH_MATCHES = "next-file-with-matches"
+    ACTION_PREVIOUS_FILE_WITH_MATCHES = "previous-file-with-matches"
+    ACTION_COPY_PATH = "copy-path"
+    ACTION_COPY_PATH_AND_LINE = "copy-path-line"
+    ACTION_COPY_LINE = "copy-line"
+    ACTION_TOGGLE_MARK = "toggle-mark"
+    ACTION_MARK_ALL = "mark-all"
+    ACTION_INVERT_MARKS = "invert-marks"
+    ACTION_REPLACE = "replace"
+    ACTION_UNDO_REPLACE = "undo-replace"
+    //binding a key to this unbinds it
+    ACTION_NONE = "none"
+    //keys bound to commands (see commands.go) are bound to this followed
+    //by the command
+    RUN_ACTION_PREFIX = "run:"
+)
+
+//Keys for scrolling through matches, marking, copying and replacing them are bound to actions with KEY=ACTION
+//bindings, on top of the default ones below. Keys are written C-x for
+//control, M-x for meta/alt (escape then x), a single char, or one of the
+//names in keyNameSequences, e.g. --bind C-u=half-page-up --bind pgdn=none.
+//Bound keys are handled before the built-in ones, so a built-in key can be
+//given an action too.
+
+var actions = []string{ACTION_PAGE_DOWN, ACTION_PAGE_UP, ACTION_HALF_PAGE_DOWN, ACTION_HALF_PAGE_UP, ACTION_FIRST, ACTION_LAST, ACTION_NEXT_FILE_WITH_MATCHES, ACTION_PREVIOUS_FILE_WITH_MATCHES, ACTION_COPY_PATH, ACTION_COPY_PATH_AND_LINE, ACTION_COPY_LINE, ACTION_TOGGLE_MARK, ACTION_MARK_ALL, ACTION_INVERT_MARKS, ACTION_REPLACE, ACTION_UNDO_REPLACE, ACTION_NONE}
+
+var defaultBindings = []string{
+    "pgdn=" + ACTION_PAGE_DOWN,
+    "C-v=" + ACTION_PAGE_DOWN,
+    "pgup=" + ACTION_PAGE_UP,
+    "M-v=" + ACTION_PAGE_UP,
+    "M-d=" + ACTION_HALF_PAGE_DOWN,
+    "M-u=" + ACTION_HALF_PAGE_UP,
+    "home=" + ACTION_FIRST,
+    "M-<=" + ACTION_FIRST,
+    "end=" + ACTION_LAST,
+    "M->=" + ACTION_LAST,
+    "M-n=" + ACTION_NEXT_FILE_WITH_MATCHES,
+    "M-p=" + ACTION_PREVIOUS_FILE_WITH_MATCHES,
+    "M-c=" + ACTION_COPY_PATH,
+    "M-l=" + ACTION_COPY_PATH_AND_LINE,
+    "M-w=" + ACTION_COPY_LINE,
+    "tab=" + ACTION_TOGGLE_MARK,
+    "M-a=" + ACTION_MARK_ALL,
+    "M-i=" + ACTION_INVERT_MARKS,
+    "M-r=" + ACTION_REPLACE,
+    "M-z=" + ACTION_UNDO_REPLACE,
+}
+
+//escape sequences sent by named keys - several for keys that terminals
+//don't agree on
+var keyNameSequences = map[string][]string{
+    "pgup": {"\u001b[5~"},
+    "pgdn": {"\u001b[6~"},
+    "home": {"\u001b[H", "\u001b[1~", "\u001b[7~", "\u001bOH"},
+    "end": {"\u001b[F", "\u001b[4~", "\u001b[8~", "\u001bOF"},
+    "up": {UP_ARROW_KEY, UP_ARROW_KEY_APPLICATION_MODE},
+    "down": {DOWN_ARROW_KEY, DOWN_ARROW_KEY_APPLICATION_MODE},
+    "C-space": {"\u0000"},
+    "tab": {"\t"},
+}
+
+//Keymap maps what a key sends to the action it's bound to
+type Keymap map[string]string
+
+//NewKeymap returns the default bindings with bindings (KEY=ACTION) applied
+//over them
+func NewKeymap(bindings []string) (Keymap, error) {
+    keymap := make(Keymap)
+    for _, binding := range append(append([]string{}, defaultBindings...), bindings...) {
+        keyName, action, ok := splitBinding(binding)
+        if !ok {
+            return nil, fmt.Errorf("invalid binding %q: has to be KEY=ACTION", binding)
+        }
+        if !isAction(action) && !strings.HasPrefix(action, RUN_ACTION_PREFIX) {
+            return nil, fmt.Errorf("invalid binding %q: action has to be one of: %v", binding, strings.Join(actions, ", "))
+        }
+        sequences, err := getKeySequences(keyName)
+        if err != nil {
+            return nil, fmt.Errorf("invalid binding %q: %v", binding, err)
+        }
+        for _, sequence := range sequences {
+            if action == ACTION_NONE {
+                delete(keymap, sequence)
+            } else {
+                keymap[sequence] = action
+            }
+        }
+    }
+    log.Printf("Using key bindings %v on top of the defaults.", bindings)
+    return keymap, nil
+}
+
+//splitBinding splits binding into the key before the first = and what it's
+//bound to after it, which can have = in it (e.g. a command), ok being false
+//if either is missing
+func splitBinding(binding string) (keyName string, boundTo string, ok bool) {
+    i := strings.Index(binding, "=")
+    //the key itself can be = or M-=, followed by another =
+    if i >= 0 && i + 1 < len(binding) && binding[i+1] == '=' {
+        i ++
+    }
+    if i <= 0 || i == len(binding) - 1 {
+        return "", "", false
+    }
+    return binding[:i], binding[i+1:], true
+}
+
+func isAction(action string) bool {
+    for _, a := range actions {
+        if a == action {
+            return true
+        }
+    }
+    return false
+}
+
+func getKeySequences(keyName string) ([]string, error) {
+    if sequences, ok := keyNameSequences[keyName]; ok {
+        return sequences, nil
+    }
+    if len(keyName) == 1 {
+        return []string{keyName}, nil
+    }
+    if len(keyName) == 3 && strings.HasPrefix(keyName, "C-") {
+        char := keyName[2]
+        if 'A' <= char && char <= 'Z' {
+            char += 'a' - 'A'
+        }
+        if char < 'a' || char > 'z' {
+            return nil, fmt.Errorf("can't use control with %q", string(char))
+        }
+        return []string{string(rune(char - 'a' + 1))}, nil
+    }
+    if len(keyName) == 3 && strings.HasPrefix(keyName, "M-") {
+        return []string{string(rune(ESCAPE)) + keyName[2:]}, nil
+    }
+    return nil, fmt.Errorf("unknown key %q", keyName)
+}
+
+//doAction does what action is bound to and renders what it changed
+func (searchManager *SearchManager) doAction(action string) {
+    log.Printf("Doing action %v.", action)
+    numberOfLines := getNumberOfLinesForMatches()
+    if strings.HasPrefix(action, RUN_ACTION_PREFIX) {
+        searchManager.runCommand(strings.TrimPrefix(action, RUN_ACTION_PREFIX))
+    }
+    switch action {
+        case ACTION_PAGE_DOWN:
+            searchManager.scrollByLines(numberOfLines)
+        case ACTION_PAGE_UP:
+            searchManager.scrollByLines(-numberOfLines)
+        case ACTION_HALF_PAGE_DOWN:
+            searchManager.scrollByLines(numberOfLines / 2)
+        case ACTION_HALF_PAGE_UP:
+            searchManager.scrollByLines(-numberOfLines / 2)
+        case ACTION_FIRST:
+            searchManager.selectMatch(0)
+        case ACTION_LAST:
+            searchManager.selectMatch(len(searchManager.filesWithMatches) - 1)
+        case ACTION_NEXT_FILE_WITH_MATCHES:
+            searchManager.selectFileWithMatches(1)
+        case ACTION_PREVIOUS_FILE_WITH_MATCHES:
+            searchManager.selectFileWithMatches(-1)
+        case ACTION_COPY_PATH, ACTION_COPY_PATH_AND_LINE, ACTION_COPY_LINE:
+            searchManager.copySelected(action)
+        case ACTION_TOGGLE_MARK:
+            searchManager.toggleMark()
+        case ACTION_MARK_ALL:
+            searchManager.markAll()
+        case ACTION_INVERT_MARKS:
+            searchManager.invertMarks()
+        case ACTION_REPLACE:
+            searchManager.startReplace()
+        case ACTION_UNDO_REPLACE:
+            searchManager.undoReplace()
+    }
+    searchManager.renderSearchTerm()
+    searchManager.renderSearchMatches()
+}
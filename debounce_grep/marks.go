@@ -0,0 +1,98 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "sort"
+)
+
+const (
+    //put before the paths of marked files
+    MARK_PREFIX = "* "
+)
+
+//Files can be marked (tab) to act on several of them at once: when any
+//files are marked, accepting prints all of them and copying copies all of
+//them instead of just the selected file. Marks are kept by path, so a file
+//stays marked when a new search matches it again, and files marked in
+//earlier searches are still acted on even if the current search doesn't
+//match them.
+
+func (searchManager *SearchManager) isMarked(path string) bool {
+    return searchManager.markedPaths[path]
+}
+
+func (searchManager *SearchManager) setMarked(path string, isMarked bool) {
+    if isMarked {
+        searchManager.markedPaths[path] = true
+    } else {
+        delete(searchManager.markedPaths, path)
+    }
+}
+
+//toggleMark marks or unmarks the selected file and selects the next one,
+//so that several files in a row can be marked by pressing tab repeatedly
+func (searchManager *SearchManager) toggleMark() {
+    if searchManager.selectedMatchIndex >= len(searchManager.filesWithMatches) {
+        return
+    }
+    path := searchManager.filesWithMatches[searchManager.selectedMatchIndex].path
+    searchManager.setMarked(path, !searchManager.isMarked(path))
+    searchManager.selectNextMatch()
+    searchManager.setMarkedStatusMessage()
+}
+
+//markAll marks all of the files matched by the current search
+func (searchManager *SearchManager) markAll() {
+    for _, file := range searchManager.filesWithMatches {
+        searchManager.setMarked(file.path, true)
+    }
+    searchManager.setMarkedStatusMessage()
+}
+
+//invertMarks marks the files matched by the current search that aren't
+//marked and unmarks the ones that are
+func (searchManager *SearchManager) invertMarks() {
+    for _, file := range searchManager.filesWithMatches {
+        searchManager.setMarked(file.path, !searchManager.isMarked(file.path))
+    }
+    searchManager.setMarkedStatusMessage()
+}
+
+func (searchManager *SearchManager) setMarkedStatusMessage() {
+    log.Printf("%v files marked.", len(searchManager.markedPaths))
+    searchManager.statusMessage = fmt.Sprintf("%v marked", len(searchManager.markedPaths))
+}
+
+//getFilesToActOn returns the marked files if any are marked, in the order
+//they're listed in followed by the ones the current search didn't match
+//by path, or else just the selected file. Files that weren't matched only
+//have their path set.
+func (searchManager *SearchManager) getFilesToActOn() []*File {
+    var files []*File
+    if len(searchManager.markedPaths) == 0 {
+        if searchManager.selectedMatchIndex < len(searchManager.filesWithMatches) {
+            files = append(files, &searchManager.filesWithMatches[searchManager.selectedMatchIndex])
+        }
+        return files
+    }
+    isMatched := make(map[string]bool)
+    for i := range searchManager.filesWithMatches {
+        file := &searchManager.filesWithMatches[i]
+        isMatched[file.path] = true
+        if searchManager.isMarked(file.path) {
+            files = append(files, file)
+        }
+    }
+    var unmatchedPaths []string
+    for path := range searchManager.markedPaths {
+        if !isMatched[path] {
+            unmatchedPaths = append(unmatchedPaths, path)
+        }
+    }
+    sort.Strings(unmatchedPaths)
+    for _, path := range unmatchedPaths {
+        files = append(files, NewFile(path, nil))
+    }
+    return files
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "log"
+)
+
+const (
+    //files the window is scrolled by for each step of the wheel
+    MOUSE_WHEEL_FILES_PER_STEP = 3
+)
+
+//With mouse tracking on (see setUpTerminal()), clicking a file selects it
+//and clicking its path again opens or closes it, the wheel scrolls the
+//window without moving the selection and clicking the scroll bar jumps to
+//that part of the matches.
+
+func (searchManager *SearchManager) handleMouseEvent(event MouseEvent) {
+    if event.isRelease {
+        return
+    }
+    log.Printf("Handling mouse event %+v.", event)
+    viewport := searchManager.getViewport()
+    switch event.button {
+        case MOUSE_WHEEL_UP:
+            viewport.scrollBy(-MOUSE_WHEEL_FILES_PER_STEP)
+            searchManager.setViewport(viewport)
+        case MOUSE_WHEEL_DOWN:
+            viewport.scrollBy(MOUSE_WHEEL_FILES_PER_STEP)
+            searchManager.setViewport(viewport)
+        case MOUSE_LEFT_BUTTON:
+            if !searchManager.handleClick(viewport, event.lineNo, event.column) {
+                return
+            }
+        default:
+            return
+    }
+    searchManager.renderSearchMatches()
+}
+
+//handleClick handles a click on lineNo and column of the tty, returning
+//false if nothing was clicked on
+func (searchManager *SearchManager) handleClick(viewport *Viewport, lineNo int, column int) bool {
+    if lineNo < SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO || lineNo > resultsLastLineNo || column > resultsWidth {
+        return false
+    }
+    linesFromTop := lineNo - SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO
+    if _, heightOfScrollBar := viewport.getScrollBar(); column == resultsWidth && heightOfScrollBar > 0 {
+        //jump to the file as far through the matches as the click is
+        //through the scroll bar's column
+        fileIndex := linesFromTop * len(searchManager.filesWithMatches) / viewport.numberOfLines
+        log.Printf("Scroll bar clicked %v lines from top, jumping to match %v.", linesFromTop, fileIndex)
+        searchManager.selectedMatchIndex = fileIndex
+        viewport.top = fileIndex
+        viewport.scrollBy(0)
+        searchManager.setViewport(viewport)
+        return true
+    }
+    fileIndex := viewport.getIndexAtLine(linesFromTop)
+    if fileIndex == -1 {
+        return false
+    }
+    isPathClicked := viewport.getLinesBetween(viewport.top, fileIndex) == linesFromTop
+    if fileIndex == searchManager.selectedMatchIndex && isPathClicked {
+        searchManager.toggleIfMatchIsOpen(fileIndex)
+    }
+    searchManager.selectMatch(fileIndex)
+    return true
+}
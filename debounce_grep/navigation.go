@@ -0,0 +1,107 @@
+package main
+
+import (
+    "fmt"
+    "log"
+)
+
+//Moving the selection through the matched files. Files take up different
+//numbers of lines of the tty, so the window is scrolled by the lines files
+//take up rather than by files (see Viewport): matchIndexAtTopOfWindow is
+//the first file in the window and cursorLineNo the line of the tty the
+//selected file starts on.
+
+//lines of the tty matched files are rendered on
+func getNumberOfLinesForMatches() int {
+    return resultsLastLineNo - SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO + 1
+}
+
+func (searchManager *SearchManager) getFileHeight(fileIndex int) int {
+    file := &searchManager.filesWithMatches[fileIndex]
+    if !file.isOpen {
+        return 1
+    }
+    return file.getNumberOfLinesRendered(searchManager.config.MaxLinesToPrintPerFile)
+}
+
+//getViewport returns the layout of filesWithMatches in the window as it's
+//scrolled now
+func (searchManager *SearchManager) getViewport() *Viewport {
+    heights := make([]int, len(searchManager.filesWithMatches))
+    for i := range heights {
+        heights[i] = searchManager.getFileHeight(i)
+    }
+    return NewViewport(heights, getNumberOfLinesForMatches(), searchManager.matchIndexAtTopOfWindow)
+}
+
+//setViewport scrolls the window to where viewport is scrolled
+func (searchManager *SearchManager) setViewport(viewport *Viewport) {
+    searchManager.matchIndexAtTopOfWindow = viewport.top
+    linesAboveSelected := viewport.getLinesBetween(viewport.top, searchManager.selectedMatchIndex)
+    searchManager.cursorLineNo = SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO + linesAboveSelected
+}
+
+//selectMatch selects the file at fileIndex, scrolling the window as little
+//as possible for all of it to be in the window - or its start if it's
+//taller than the window
+func (searchManager *SearchManager) selectMatch(fileIndex int) {
+    numberOfFiles := len(searchManager.filesWithMatches)
+    if numberOfFiles == 0 {
+        return
+    }
+    if fileIndex < 0 {
+        fileIndex = 0
+    } else if fileIndex >= numberOfFiles {
+        fileIndex = numberOfFiles - 1
+    }
+    searchManager.selectedMatchIndex = fileIndex
+    viewport := searchManager.getViewport()
+    viewport.scrollTo(fileIndex)
+    searchManager.setViewport(viewport)
+    log.Printf("Selected match %v, window now starts at match %v with selected match on line %v.", fileIndex, searchManager.matchIndexAtTopOfWindow, searchManager.cursorLineNo)
+}
+
+//scrollToLine scrolls the window so that the selected file starts on
+//lineNo of the tty, or as close to it as it can be
+func (searchManager *SearchManager) scrollToLine(lineNo int) {
+    viewport := searchManager.getViewport()
+    viewport.scrollToLine(searchManager.selectedMatchIndex, lineNo - SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO)
+    searchManager.setViewport(viewport)
+}
+
+//scrollByLines moves both the window and the selection about numberOfLines
+//lines, like C-d/C-u in vim, so that the selected file stays on about the
+//same line of the tty
+func (searchManager *SearchManager) scrollByLines(numberOfLines int) {
+    if len(searchManager.filesWithMatches) == 0 {
+        return
+    }
+    searchManager.selectedMatchIndex = searchManager.getViewport().getIndexLinesAway(searchManager.selectedMatchIndex, numberOfLines)
+    searchManager.scrollToLine(searchManager.cursorLineNo)
+}
+
+func (searchManager *SearchManager) selectNextMatch() {
+    searchManager.selectMatch(searchManager.selectedMatchIndex + 1)
+}
+
+func (searchManager *SearchManager) selectPreviousMatch() {
+    searchManager.selectMatch(searchManager.selectedMatchIndex - 1)
+}
+
+//selectFileWithMatches selects the next file (step 1) or previous file
+//(step -1) with at least config.JumpMinMatches matches, leaving the
+//selection where it is with a status message if there isn't one
+func (searchManager *SearchManager) selectFileWithMatches(step int) {
+    minMatches := searchManager.config.JumpMinMatches
+    for fileIndex := searchManager.selectedMatchIndex + step; 0 <= fileIndex && fileIndex < len(searchManager.filesWithMatches); fileIndex += step {
+        if searchManager.filesWithMatches[fileIndex].getNumberOfMatches() >= minMatches {
+            searchManager.selectMatch(fileIndex)
+            return
+        }
+    }
+    direction := "below"
+    if step < 0 {
+        direction = "above"
+    }
+    searchManager.statusMessage = fmt.Sprintf("no file %v with %v+ matches", direction, minMatches)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "strings"
+)
+
+//The pager shows the output of commands (see commands.go) in place of the
+//matches until it's closed with q, escape, C-g or enter. It scrolls like
+//less: j/k (or C-j/C-k, up/down, the wheel) a line at a time, space/b (or
+//pgdn/pgup) a page at a time and g/G (or home/end) to the top and bottom.
+
+//PagerLine is a line shown in the pager, either the header naming a command
+//or a line it output
+type PagerLine struct {
+    text string
+    isHeader bool
+}
+
+func (searchManager *SearchManager) openPager(lines []PagerLine) {
+    log.Printf("Opening pager with %v lines.", len(lines))
+    searchManager.pagerLines = lines
+    searchManager.pagerScrollOffset = 0
+    searchManager.statusMessage = "q closes output"
+}
+
+func (searchManager *SearchManager) closePager() {
+    searchManager.pagerLines = nil
+    searchManager.statusMessage = ""
+}
+
+func (searchManager *SearchManager) isPagerOpen() bool {
+    return searchManager.pagerLines != nil
+}
+
+//lines of the tty the pager is rendered on, all of them below the search
+//term whether or not the preview is shown
+func getNumberOfLinesForPager() int {
+    return ttyHeight - SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO + 1
+}
+
+func (searchManager *SearchManager) scrollPager(numberOfLines int) {
+    maxScrollOffset := len(searchManager.pagerLines) - getNumberOfLinesForPager()
+    searchManager.pagerScrollOffset = minInt(searchManager.pagerScrollOffset + numberOfLines, maxScrollOffset)
+    searchManager.pagerScrollOffset = maxInt(searchManager.pagerScrollOffset, 0)
+}
+
+func (searchManager *SearchManager) handlePagerCommands(stdin []byte) {
+    pageLength := getNumberOfLinesForPager()
+    key := string(stdin)
+    if mouseEvent, ok := parseMouseEvent(stdin); ok {
+        if mouseEvent.isRelease {
+            return
+        } else if mouseEvent.button == MOUSE_WHEEL_UP {
+            searchManager.scrollPager(-MOUSE_WHEEL_FILES_PER_STEP)
+        } else if mouseEvent.button == MOUSE_WHEEL_DOWN {
+            searchManager.scrollPager(MOUSE_WHEEL_FILES_PER_STEP)
+        }
+
+    } else if key == "j" || isDownKey(stdin) || stdin[0] == 10 || stdin[0] == 14 { // C-j or C-n
+        searchManager.scrollPager(1)
+
+    } else if key == "k" || isUpKey(stdin) || stdin[0] == 11 || stdin[0] == 16 { // C-k or C-p
+        searchManager.scrollPager(-1)
+
+    } else if key == " " || stdin[0] == 22 || isBoundTo(key, ACTION_PAGE_DOWN) { // C-v
+        searchManager.scrollPager(pageLength)
+
+    } else if key == "b" || isBoundTo(key, ACTION_PAGE_UP) {
+        searchManager.scrollPager(-pageLength)
+
+    } else if key == "g" || isBoundTo(key, ACTION_FIRST) {
+        searchManager.pagerScrollOffset = 0
+
+    } else if key == "G" || isBoundTo(key, ACTION_LAST) {
+        searchManager.scrollPager(len(searchManager.pagerLines))
+
+    } else if key == "q" || key == string(rune(ESCAPE)) || stdin[0] == CTRL_G || stdin[0] == ENTER {
+        searchManager.closePager()
+        searchManager.renderSearchTerm()
+
+    } else {
+        return
+    }
+    searchManager.renderSearchMatches()
+}
+
+//isBoundTo returns whether key is one of the default keys for action, so
+//that pgdn, home etc. page through output too
+func isBoundTo(key string, action string) bool {
+    for _, binding := range defaultBindings {
+        keyName, boundTo, _ := splitBinding(binding)
+        if boundTo != action {
+            continue
+        }
+        sequences, _ := getKeySequences(keyName)
+        for _, sequence := range sequences {
+            if sequence == key {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+func (searchManager *SearchManager) renderPager() {
+    numberOfLines := getNumberOfLinesForPager()
+    for i := 0; i < numberOfLines && searchManager.pagerScrollOffset + i < len(searchManager.pagerLines); i++ {
+        pagerLine := searchManager.pagerLines[searchManager.pagerScrollOffset + i]
+        //codes and carriage returns in the output would move the cursor
+        line := strings.Replace(ansiCodeRegexp.ReplaceAllString(pagerLine.text, ""), "\r", "", -1)
+        line = strings.Replace(line, "\t", PREVIEW_TAB, -1)
+        searchManager.navigateToLineAndColumn(SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO + i, 1)
+        if pagerLine.isHeader {
+            fmt.Fprint(screen, theme.lineNumber)
+        }
+        fmt.Fprint(screen, truncateEntity(line, ttyWidth))
+        fmt.Fprint(screen, CANCEL_COLOR_CODE)
+    }
+}
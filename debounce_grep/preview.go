@@ -0,0 +1,218 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "strings"
+)
+
+const (
+    PREVIEW_NONE = "none"
+    PREVIEW_RIGHT = "right"
+    PREVIEW_BOTTOM = "bottom"
+    PREVIEW_VERTICAL_BORDER = "│"
+    PREVIEW_HORIZONTAL_BORDER = "─"
+    //tabs are expanded so that the width of preview lines is known
+    PREVIEW_TAB = "    "
+)
+
+//The preview pane shows the text of the selected file around its first
+//matched line, to the right of or below the matches. It scrolls separately
+//from the matches (C-e/C-y) and goes back to being centered on the match
+//when another file is selected.
+
+//updateLayout splits the tty between the matches and the preview pane
+func (searchManager *SearchManager) updateLayout() {
+    resultsWidth = ttyWidth
+    resultsLastLineNo = ttyHeight
+    switch searchManager.previewPosition {
+        case PREVIEW_RIGHT:
+            //border takes one column
+            resultsWidth = ttyWidth - searchManager.getPreviewWidth() - 1
+        case PREVIEW_BOTTOM:
+            //border takes one line
+            resultsLastLineNo = ttyHeight - searchManager.getPreviewHeight() - 1
+    }
+    spaceForMatchText = resultsWidth - 1 - len(SEARCH_MATCH_SPACE_INDENT) - len(LINE_NO_BUFFER) - SCROLL_BAR_WIDTH
+    log.Printf("Layout updated for preview %v: results %v wide to line %v, %v of space for match text.", searchManager.previewPosition, resultsWidth, resultsLastLineNo, spaceForMatchText)
+}
+
+func (searchManager *SearchManager) getPreviewWidth() int {
+    if searchManager.previewPosition == PREVIEW_RIGHT {
+        return ttyWidth / 2
+    }
+    return ttyWidth
+}
+
+func (searchManager *SearchManager) getPreviewHeight() int {
+    linesBelowSearchTerm := ttyHeight - SEARCH_TERM_TERMINAL_LINE_NO
+    if searchManager.previewPosition == PREVIEW_BOTTOM {
+        return linesBelowSearchTerm / 2
+    }
+    return linesBelowSearchTerm
+}
+
+//line and column the preview starts at
+func (searchManager *SearchManager) getPreviewOrigin() (int, int) {
+    if searchManager.previewPosition == PREVIEW_RIGHT {
+        return SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO, resultsWidth + 2
+    }
+    return resultsLastLineNo + 2, 1
+}
+
+func (searchManager *SearchManager) togglePreview() {
+    if searchManager.previewPosition == PREVIEW_NONE {
+        searchManager.previewPosition = searchManager.config.PreviewPosition
+        if searchManager.previewPosition == PREVIEW_NONE {
+            searchManager.previewPosition = PREVIEW_RIGHT
+        }
+    } else {
+        searchManager.previewPosition = PREVIEW_NONE
+    }
+    searchManager.updateLayout()
+}
+
+func (searchManager *SearchManager) scrollPreview(numberOfLines int) {
+    if searchManager.previewPosition == PREVIEW_NONE {
+        return
+    }
+    searchManager.previewScrollOffset += numberOfLines
+    searchManager.renderPreview()
+    searchManager.positionCursorAtIndex()
+}
+
+//getFirstLineWithMatches returns the line the preview is centered on: the
+//best matching line for fuzzy queries, the first matched line otherwise
+func (file *File) getFirstLineWithMatches() *LineWithMatches {
+    var firstLineWithMatches *LineWithMatches
+    for i, lineWithMatches := range file.linesWithMatches {
+        if firstLineWithMatches == nil || lineWithMatches.score > firstLineWithMatches.score ||
+            (lineWithMatches.score == firstLineWithMatches.score && lineWithMatches.lineNo < firstLineWithMatches.lineNo) {
+            firstLineWithMatches = &file.linesWithMatches[i]
+        }
+    }
+    return firstLineWithMatches
+}
+
+func (searchManager *SearchManager) loadPreviewLines(file *File) {
+    if file.path == searchManager.previewPath {
+        return
+    }
+    lines, err := file.source.ReadLines()
+    if err != nil {
+        log.Printf("Could not read %v for preview: %v", file.path, err)
+    }
+    searchManager.previewPath = file.path
+    searchManager.previewLines = lines
+    searchManager.previewScrollOffset = 0
+}
+
+//getPreviewTopLineIndex returns the index of the first line shown in the
+//preview, which is scrolled previewScrollOffset lines from having the match
+//centered, clamping the offset so that it can't scroll past the file
+func (searchManager *SearchManager) getPreviewTopLineIndex(file *File, height int) int {
+    centeredTop := 0
+    if firstLineWithMatches := file.getFirstLineWithMatches(); firstLineWithMatches != nil {
+        centeredTop = firstLineWithMatches.lineNo - 1 - height / 2
+    }
+    maxTop := len(searchManager.previewLines) - height
+    if maxTop < 0 {
+        maxTop = 0
+    }
+    top := centeredTop + searchManager.previewScrollOffset
+    if top < 0 {
+        top = 0
+    } else if top > maxTop {
+        top = maxTop
+    }
+    searchManager.previewScrollOffset = top - centeredTop
+    return top
+}
+
+func (searchManager *SearchManager) renderPreview() {
+    if searchManager.previewPosition == PREVIEW_NONE {
+        return
+    }
+    searchManager.renderPreviewBorder()
+    width, height := searchManager.getPreviewWidth(), searchManager.getPreviewHeight()
+    originLineNo, originColumn := searchManager.getPreviewOrigin()
+    var file *File
+    if searchManager.selectedMatchIndex < len(searchManager.filesWithMatches) {
+        file = &searchManager.filesWithMatches[searchManager.selectedMatchIndex]
+        searchManager.loadPreviewLines(file)
+    }
+    top := 0
+    matchIndecesOfLine := make(map[int][][]int)
+    if file != nil {
+        top = searchManager.getPreviewTopLineIndex(file, height)
+        for _, lineWithMatches := range file.linesWithMatches {
+            matchIndecesOfLine[lineWithMatches.lineNo] = lineWithMatches.matchIndeces
+        }
+    }
+    for row := 0; row < height; row++ {
+        searchManager.navigateToLineAndColumn(originLineNo + row, originColumn)
+        lineIndex := top + row
+        if file == nil || lineIndex >= len(searchManager.previewLines) {
+            fmt.Fprint(screen, strings.Repeat(SPACE, width))
+            continue
+        }
+        lineNo := lineIndex + 1
+        text := searchManager.previewLines[lineIndex]
+        syntaxColors := file.getSyntaxColorsOfLine(searchManager.config.IsSyntaxHighlighted, text)
+        fmt.Fprint(screen, getPreviewLine(lineNo, text, matchIndecesOfLine[lineNo], syntaxColors, width))
+    }
+}
+
+func (searchManager *SearchManager) renderPreviewBorder() {
+    if searchManager.previewPosition == PREVIEW_RIGHT {
+        for lineNo := SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO; lineNo <= ttyHeight; lineNo++ {
+            searchManager.navigateToLineAndColumn(lineNo, resultsWidth + 1)
+            fmt.Fprint(screen, PREVIEW_VERTICAL_BORDER)
+        }
+    } else {
+        searchManager.navigateToLineAndColumn(resultsLastLineNo + 1, 1)
+        fmt.Fprint(screen, strings.Repeat(PREVIEW_HORIZONTAL_BORDER, ttyWidth))
+    }
+}
+
+//getPreviewLine returns a line of the file with its line number and its
+//matches (and syntax, if syntaxColors isn't nil) highlighted, cut off or padded with spaces to be exactly width
+//cells wide so that it covers whatever was rendered there before
+func getPreviewLine(lineNo int, text string, matchIndeces [][]int, syntaxColors []string, width int) string {
+    lineNoString := fmt.Sprintf("%4d ", lineNo)
+    if len(lineNoString) >= width {
+        return strings.Repeat(SPACE, width)
+    }
+    var previewLine strings.Builder
+    previewLine.WriteString(theme.lineNumber + lineNoString + CANCEL_COLOR_CODE)
+    charsLeft := width - len(lineNoString)
+    matchIndexPairIndex := 0
+    currentColorCode := ""
+    for charIndex, char := range text {
+        if charsLeft <= 0 || getRuneWidth(char) > charsLeft {
+            break
+        }
+        colorCode := getCharColorCode(charIndex, matchIndeces, &matchIndexPairIndex, syntaxColors)
+        if colorCode != currentColorCode {
+            if currentColorCode != "" {
+                previewLine.WriteString(CANCEL_COLOR_CODE)
+            }
+            previewLine.WriteString(colorCode)
+            currentColorCode = colorCode
+        }
+        charToWrite := string(char)
+        if char == '\t' {
+            charToWrite = PREVIEW_TAB
+            if len(charToWrite) > charsLeft {
+                charToWrite = charToWrite[:charsLeft]
+            }
+        }
+        previewLine.WriteString(charToWrite)
+        charsLeft -= getStringWidth(charToWrite)
+    }
+    if currentColorCode != "" {
+        previewLine.WriteString(CANCEL_COLOR_CODE)
+    }
+    previewLine.WriteString(strings.Repeat(SPACE, charsLeft))
+    return previewLine.String()
+}
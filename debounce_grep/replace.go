@@ -0,0 +1,337 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "regexp"
+    "strings"
+
+    "debounce_grep/replace"
+    "debounce_grep/search"
+)
+
+const (
+    REPLACE_STEP_NONE = ""
+    //typing the pattern to replace, then what to replace it with
+    REPLACE_STEP_PATTERN = "pattern"
+    REPLACE_STEP_REPLACEMENT = "replacement"
+    //accepting or rejecting each change
+    REPLACE_STEP_REVIEW = "review"
+    REPLACE_PATTERN_PROMPT = "replace: "
+    REPLACEMENT_PROMPT = "replace %v with: "
+    REPLACE_REVIEW_HELP = "y/n line, Y/N file, A/R all, enter writes"
+    CHANGE_PENDING = ' '
+    CHANGE_ACCEPTED = 'y'
+    CHANGE_REJECTED = 'n'
+)
+
+//Replacing (M-r) changes the text matched in the lines with matches of the
+//matched files - or of the marked ones, if any are marked. The pattern to
+//replace starts out as the terms of the query, as a regexp, and can be
+//edited, e.g. to add capture groups for the replacement to use as $1, ${2}
+//etc. Each line that would change is then shown before and after, and the
+//changes are accepted or rejected a line, a file or all of them at a time
+//before the accepted ones are written. The changes written last are kept
+//in a journal in config.DataDir so that they can be undone (M-z), even
+//after quitting.
+
+type ReplaceChange struct {
+    replace.Change
+    //one of the CHANGE_ constants
+    state rune
+}
+
+func (searchManager *SearchManager) isReplacing() bool {
+    return searchManager.replaceStep != REPLACE_STEP_NONE
+}
+
+//startReplace starts typing the pattern to replace, the query's terms
+//being replaced by default
+func (searchManager *SearchManager) startReplace() {
+    if len(searchManager.filesWithMatches) == 0 {
+        searchManager.statusMessage = "nothing to replace"
+        return
+    }
+    var terms []string
+    if query, err := search.ParseQuery(searchManager.searchTerm, search.Scope(searchManager.config.QueryScope)); err == nil {
+        for _, term := range query.PositiveTerms() {
+            terms = append(terms, regexp.QuoteMeta(term))
+        }
+    }
+    searchManager.replaceStep = REPLACE_STEP_PATTERN
+    searchManager.replacePattern = strings.Join(terms, "|")
+    searchManager.replacement = ""
+    searchManager.statusMessage = ""
+    log.Printf("Started replacing, pattern %q.", searchManager.replacePattern)
+}
+
+func (searchManager *SearchManager) stopReplacing() {
+    searchManager.replaceStep = REPLACE_STEP_NONE
+    searchManager.replaceChanges = nil
+    searchManager.replaceChangeIndex = 0
+}
+
+func (searchManager *SearchManager) handleReplaceCommands(stdin []byte) {
+    if searchManager.replaceStep == REPLACE_STEP_REVIEW {
+        searchManager.handleReviewCommands(stdin)
+        return
+    }
+    prompt := &searchManager.replacePattern
+    if searchManager.replaceStep == REPLACE_STEP_REPLACEMENT {
+        prompt = &searchManager.replacement
+    }
+    if len(stdin) == 1 && 32 <= stdin[0] && stdin[0] <= 126 {
+        *prompt += string(stdin)
+
+    } else if stdin[0] == 127 { // backspace
+        if len(*prompt) > 0 {
+            *prompt = (*prompt)[:len(*prompt)-1]
+        }
+
+    } else if stdin[0] == ENTER {
+        searchManager.confirmReplacePrompt()
+
+    } else if stdin[0] == CTRL_G || string(stdin) == string(rune(ESCAPE)) {
+        log.Printf("Cancelled replacing.")
+        searchManager.stopReplacing()
+        searchManager.renderSearchMatches()
+    }
+    searchManager.renderSearchTerm()
+}
+
+//confirmReplacePrompt goes on from typing the pattern to typing the
+//replacement, and from there to reviewing the changes
+func (searchManager *SearchManager) confirmReplacePrompt() {
+    pattern, err := regexp.Compile(searchManager.replacePattern)
+    if err != nil || searchManager.replacePattern == "" {
+        searchManager.statusMessage = "invalid pattern"
+        return
+    }
+    searchManager.statusMessage = ""
+    if searchManager.replaceStep == REPLACE_STEP_PATTERN {
+        searchManager.replaceStep = REPLACE_STEP_REPLACEMENT
+        return
+    }
+    searchManager.replaceChanges = searchManager.getReplaceChanges(pattern, searchManager.replacement)
+    if len(searchManager.replaceChanges) == 0 {
+        searchManager.stopReplacing()
+        searchManager.statusMessage = "nothing to replace"
+        return
+    }
+    log.Printf("Reviewing %v changes.", len(searchManager.replaceChanges))
+    searchManager.replaceStep = REPLACE_STEP_REVIEW
+    searchManager.replaceChangeIndex = 0
+    searchManager.replaceScrollOffset = 0
+    searchManager.statusMessage = REPLACE_REVIEW_HELP
+    searchManager.renderSearchMatches()
+}
+
+//getReplaceChanges returns the changes replacing pattern with replacement
+//makes to the lines with matches of the files replaced in. Compressed files,
+//members of archives and stdin are left out, since they can't be written
+//to.
+func (searchManager *SearchManager) getReplaceChanges(pattern *regexp.Regexp, replacement string) []ReplaceChange {
+    var files []*File
+    for i := range searchManager.filesWithMatches {
+        file := &searchManager.filesWithMatches[i]
+        if file.source.IsArchiveMember() || file.source.IsVirtual() || file.source.IsCompressed() {
+            continue
+        }
+        if len(searchManager.markedPaths) == 0 || searchManager.isMarked(file.path) {
+            files = append(files, file)
+        }
+    }
+    var changes []ReplaceChange
+    for _, file := range files {
+        for _, lineWithMatches := range file.linesWithMatches {
+            change, ok := replace.GetChange(file.path, lineWithMatches.lineNo, lineWithMatches.text, pattern, replacement)
+            if !ok {
+                continue
+            }
+            changes = append(changes, ReplaceChange{Change: change, state: CHANGE_PENDING})
+        }
+    }
+    return changes
+}
+
+func (searchManager *SearchManager) handleReviewCommands(stdin []byte) {
+    changes := searchManager.replaceChanges
+    current := &changes[searchManager.replaceChangeIndex]
+    key := string(stdin)
+    if key == "j" || isDownKey(stdin) || stdin[0] == 10 || stdin[0] == 14 { // C-j or C-n
+        searchManager.selectChange(searchManager.replaceChangeIndex + 1)
+
+    } else if key == "k" || isUpKey(stdin) || stdin[0] == 11 || stdin[0] == 16 { // C-k or C-p
+        searchManager.selectChange(searchManager.replaceChangeIndex - 1)
+
+    } else if key == "y" || key == "n" {
+        current.state = rune(key[0])
+        searchManager.selectChange(searchManager.replaceChangeIndex + 1)
+
+    } else if key == "Y" || key == "N" {
+        for i := range changes {
+            if changes[i].Path == current.Path {
+                changes[i].state = rune(strings.ToLower(key)[0])
+            }
+        }
+
+    } else if key == "A" || key == "R" {
+        state := CHANGE_ACCEPTED
+        if key == "R" {
+            state = CHANGE_REJECTED
+        }
+        for i := range changes {
+            changes[i].state = state
+        }
+
+    } else if stdin[0] == ENTER {
+        searchManager.writeAcceptedChanges()
+        searchManager.renderSearchTerm()
+        searchManager.renderSearchMatches()
+        return
+
+    } else if key == "q" || stdin[0] == CTRL_G || key == string(rune(ESCAPE)) {
+        log.Printf("Cancelled replacing.")
+        searchManager.stopReplacing()
+        searchManager.statusMessage = ""
+
+    } else {
+        return
+    }
+    if searchManager.isReplacing() {
+        searchManager.statusMessage = fmt.Sprintf("%v of %v accepted - %v", searchManager.getNumberOfAcceptedChanges(), len(changes), REPLACE_REVIEW_HELP)
+    }
+    searchManager.renderSearchTerm()
+    searchManager.renderSearchMatches()
+}
+
+func (searchManager *SearchManager) getNumberOfAcceptedChanges() int {
+    numberOfAccepted := 0
+    for _, change := range searchManager.replaceChanges {
+        if change.state == CHANGE_ACCEPTED {
+            numberOfAccepted ++
+        }
+    }
+    return numberOfAccepted
+}
+
+func (searchManager *SearchManager) selectChange(changeIndex int) {
+    searchManager.replaceChangeIndex = maxInt(minInt(changeIndex, len(searchManager.replaceChanges) - 1), 0)
+}
+
+//writeAcceptedChanges writes the accepted changes, saves them to the
+//journal and searches the files again
+func (searchManager *SearchManager) writeAcceptedChanges() {
+    var accepted []replace.Change
+    for _, change := range searchManager.replaceChanges {
+        if change.state == CHANGE_ACCEPTED {
+            accepted = append(accepted, change.Change)
+        }
+    }
+    searchManager.stopReplacing()
+    if len(accepted) == 0 {
+        searchManager.statusMessage = "nothing accepted"
+        return
+    }
+    applied, err := replace.Apply(accepted)
+    if len(applied) > 0 {
+        if journalErr := searchManager.replaceJournal.Save(applied); journalErr != nil {
+            log.Printf("Could not save replace journal: %v", journalErr)
+        }
+    }
+    //searching again clears the status message, so it's set after
+    searchManager.refreshFilesToSearch()
+    searchManager.statusMessage = describeChanges("replaced", applied, err)
+}
+
+//undoReplace undoes the changes in the journal
+func (searchManager *SearchManager) undoReplace() {
+    reverted, err := searchManager.replaceJournal.Undo()
+    if len(reverted) == 0 && err == nil {
+        searchManager.statusMessage = "nothing to undo"
+        return
+    }
+    searchManager.refreshFilesToSearch()
+    searchManager.statusMessage = describeChanges("undid", reverted, err)
+}
+
+//describeChanges describes what was done to changes for the status message
+func describeChanges(verb string, changes []replace.Change, err error) string {
+    isPath := make(map[string]bool)
+    for _, change := range changes {
+        isPath[change.Path] = true
+    }
+    description := fmt.Sprintf("%v %v lines in %v files", verb, len(changes), len(isPath))
+    if err != nil {
+        description += fmt.Sprintf(", failed: %v", err)
+    }
+    return description
+}
+
+func (searchManager *SearchManager) getReplacePrompt() string {
+    if searchManager.replaceStep == REPLACE_STEP_REPLACEMENT {
+        return fmt.Sprintf(REPLACEMENT_PROMPT, searchManager.replacePattern) + searchManager.replacement
+    }
+    return REPLACE_PATTERN_PROMPT + searchManager.replacePattern
+}
+
+func (searchManager *SearchManager) renderReplacePrompt() {
+    searchManager.clearTerminalLine(SEARCH_TERM_TERMINAL_LINE_NO)
+    fmt.Fprint(screen, theme.typing + searchManager.getReplacePrompt() + CANCEL_COLOR_CODE)
+    searchManager.renderStatusMessage()
+    searchManager.positionCursorAtIndex()
+}
+
+//ReviewLine is a line of the review of changes: a file's path, or the
+//line a change is to before or after it
+type ReviewLine struct {
+    text string
+    colorCode string
+    //index of the change the line is part of, -1 for paths
+    changeIndex int
+}
+
+func (searchManager *SearchManager) getReviewLines() []ReviewLine {
+    var lines []ReviewLine
+    for i, change := range searchManager.replaceChanges {
+        if i == 0 || change.Path != searchManager.replaceChanges[i-1].Path {
+            lines = append(lines, ReviewLine{text: change.Path, changeIndex: -1})
+        }
+        lineNo := fmt.Sprintf("%-*v", len(LINE_NO_BUFFER), change.LineNo)
+        lines = append(lines, ReviewLine{text: fmt.Sprintf("[%c] %v- %v", change.state, lineNo, change.Old), colorCode: theme.negative, changeIndex: i})
+        lines = append(lines, ReviewLine{text: fmt.Sprintf("    %v+ %v", strings.Repeat(" ", len(lineNo)), change.New), colorCode: theme.positive, changeIndex: i})
+    }
+    return lines
+}
+
+//renderReview renders the changes in place of the matches, scrolled for the
+//selected change to be in the window
+func (searchManager *SearchManager) renderReview() {
+    lines := searchManager.getReviewLines()
+    numberOfLines := ttyHeight - SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO + 1
+    for i, line := range lines {
+        if line.changeIndex != searchManager.replaceChangeIndex {
+            continue
+        }
+        if i < searchManager.replaceScrollOffset {
+            //keep the path of the selected change's file in sight too
+            searchManager.replaceScrollOffset = i
+            if i > 0 && lines[i-1].changeIndex == -1 {
+                searchManager.replaceScrollOffset = i - 1
+            }
+        } else if i + 2 > searchManager.replaceScrollOffset + numberOfLines {
+            searchManager.replaceScrollOffset = i + 2 - numberOfLines
+        }
+        break
+    }
+    for i := 0; i < numberOfLines && searchManager.replaceScrollOffset + i < len(lines); i++ {
+        line := lines[searchManager.replaceScrollOffset + i]
+        text := strings.Replace(line.text, "\t", PREVIEW_TAB, -1)
+        colorCode := line.colorCode
+        if line.changeIndex == searchManager.replaceChangeIndex {
+            colorCode = theme.selectedFile
+        }
+        searchManager.navigateToLineAndColumn(SEARCH_MATCH_SPACE_START_TERMINAL_LINE_NO + i, 1)
+        fmt.Fprint(screen, colorCode + truncateEntity(text, ttyWidth) + CANCEL_COLOR_CODE)
+    }
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+    "os"
+)
+
+//there's no SIGWINCH on other platforms, so the layout stays the size the
+//tty was when the program started
+func notifyOfResizes(resizeChannel chan os.Signal) {
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+    "os"
+    "os/signal"
+    "syscall"
+)
+
+//notifyOfResizes sends to resizeChannel when the tty is resized
+func notifyOfResizes(resizeChannel chan os.Signal) {
+    signal.Notify(resizeChannel, syscall.SIGWINCH)
+}
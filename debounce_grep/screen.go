@@ -0,0 +1,382 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "unicode/utf8"
+)
+
+const (
+    ESCAPE_CODE_START = "\u001b["
+    //operating system commands (e.g. OSC 52 to copy to the clipboard)
+    //start with this and end with BEL or ESC \
+    OPERATING_SYSTEM_COMMAND_START = "\u001b]"
+    BELL = '\u0007'
+    HIDE_CURSOR_CODE = "\u001b[?25l"
+    SHOW_CURSOR_CODE = "\u001b[?25h"
+    CLEAR_SCREEN_CODE = "\u001b[2J"
+    TAB_WIDTH = 8
+)
+
+//Everything is rendered into a Screen instead of straight to the tty. The
+//Screen keeps a grid of the cells of the tty, which the text and the
+//cursor, color and clear line codes written to it are applied to like a
+//terminal would apply them. Flush() then compares the grid to what was
+//flushed last and writes only the cells that changed, in one write, so
+//that components can keep clearing and re-rendering all of their lines
+//without the tty flickering. The tty can be given back with Leave(), and
+//interrupts do that from another goroutine (see setUpTerminal()), so all of
+//the Screen's methods hold its mutex.
+
+type Cell struct {
+    //WIDE_CHAR_CONTINUATION in the second cell of a wide char (see
+    //getRuneWidth()), which the wide char is drawn over
+    char rune
+    //chars that take no cells (e.g. combining accents), drawn after char
+    combining string
+    //color codes the char is rendered with, "" for none
+    style string
+}
+
+const WIDE_CHAR_CONTINUATION rune = 0
+
+var blankCell = Cell{char: ' '}
+
+type Screen struct {
+    height int
+    width int
+    //what is being rendered
+    cells [][]Cell
+    //what is on the tty, nil before the first flush
+    shownCells [][]Cell
+    //where the tty's cursor was put by the last flush
+    shownCursorLineNo int
+    shownCursorColumn int
+    cursorLineNo int
+    cursorColumn int
+    style string
+    //end of the last write if it was in the middle of an escape code or
+    //of a utf8 char
+    pending []byte
+    out *bufio.Writer
+    //set by Leave() until Invalidate(), while nothing is flushed
+    isLeft bool
+    mutex sync.Mutex
+}
+
+//all rendering is written to this screen, made by openTerminal()
+var screen *Screen
+
+func NewScreen(out io.Writer, height int, width int) *Screen {
+    screen := &Screen{}
+    screen.height = height
+    screen.width = width
+    screen.cells = newCells(height, width)
+    screen.cursorLineNo = 1
+    screen.cursorColumn = 1
+    screen.out = bufio.NewWriterSize(out, 64 * 1024)
+    return screen
+}
+
+func newCells(height int, width int) [][]Cell {
+    cells := make([][]Cell, height)
+    for i := range cells {
+        cells[i] = make([]Cell, width)
+        for j := range cells[i] {
+            cells[i][j] = blankCell
+        }
+    }
+    return cells
+}
+
+//Write applies p to the grid. Text past the bottom of the tty is dropped
+//instead of scrolling it.
+func (screen *Screen) Write(p []byte) (int, error) {
+    screen.mutex.Lock()
+    defer screen.mutex.Unlock()
+    data := append(screen.pending, p...)
+    screen.pending = nil
+    for len(data) > 0 {
+        if data[0] == '\u001b' {
+            length := getEscapeCodeLength(data)
+            if length == 0 {
+                screen.pending = append([]byte{}, data...)
+                break
+            }
+            screen.applyEscapeCode(string(data[:length]))
+            data = data[length:]
+            continue
+        }
+        if !utf8.FullRune(data) {
+            screen.pending = append([]byte{}, data...)
+            break
+        }
+        char, size := utf8.DecodeRune(data)
+        data = data[size:]
+        switch char {
+            case '\n':
+                screen.cursorLineNo ++
+                screen.cursorColumn = 1
+            case '\r':
+                screen.cursorColumn = 1
+            case '\t':
+                nextTabStop := (screen.cursorColumn - 1) / TAB_WIDTH * TAB_WIDTH + TAB_WIDTH + 1
+                for screen.cursorColumn < nextTabStop {
+                    screen.putChar(' ')
+                }
+            default:
+                screen.putChar(char)
+        }
+    }
+    return len(p), nil
+}
+
+//putChar puts char in the cells under the cursor and moves the cursor right
+//past them, wrapping to the next line at the end of a line. A wide char
+//that doesn't fit at the end of a line is put on the next one, like
+//terminals do, and a char that takes no cells is added to the char before.
+func (screen *Screen) putChar(char rune) {
+    width := getRuneWidth(char)
+    if width == 0 {
+        screen.combineWithPreviousChar(char)
+        return
+    }
+    if screen.cursorColumn + width - 1 > screen.width {
+        if screen.cursorColumn <= screen.width {
+            screen.setCell(screen.cursorColumn, Cell{char: ' ', style: screen.style})
+        }
+        screen.cursorLineNo ++
+        screen.cursorColumn = 1
+    }
+    screen.setCell(screen.cursorColumn, Cell{char: char, style: screen.style})
+    if width == 2 {
+        screen.setCell(screen.cursorColumn + 1, Cell{char: WIDE_CHAR_CONTINUATION, style: screen.style})
+    }
+    screen.cursorColumn += width
+}
+
+//setCell sets the cell at column of the cursor's line, blanking the rest of
+//any wide char it's put over half of
+func (screen *Screen) setCell(column int, cell Cell) {
+    if screen.cursorLineNo < 1 || screen.cursorLineNo > screen.height {
+        return
+    }
+    line := screen.cells[screen.cursorLineNo-1]
+    //the continuation of a wide char is put right after the wide char
+    if cell.char != WIDE_CHAR_CONTINUATION && line[column-1].char == WIDE_CHAR_CONTINUATION && column > 1 {
+        line[column-2] = blankCell
+    }
+    if column < screen.width && line[column].char == WIDE_CHAR_CONTINUATION {
+        line[column] = blankCell
+    }
+    line[column-1] = cell
+}
+
+func (screen *Screen) combineWithPreviousChar(char rune) {
+    column := screen.cursorColumn - 1
+    if screen.cursorLineNo < 1 || screen.cursorLineNo > screen.height || column < 1 || column > screen.width {
+        return
+    }
+    line := screen.cells[screen.cursorLineNo-1]
+    if line[column-1].char == WIDE_CHAR_CONTINUATION && column > 1 {
+        column --
+    }
+    line[column-1].combining += string(char)
+}
+
+//getEscapeCodeLength returns the length of the CSI or OSC escape code data
+//starts with, 0 if data ends before it does
+func getEscapeCodeLength(data []byte) int {
+    if len(data) < 2 {
+        return 0
+    }
+    if data[1] == ']' {
+        for i := 2; i < len(data); i++ {
+            if data[i] == BELL {
+                return i + 1
+            }
+            if data[i] == '\u001b' && i + 1 < len(data) && data[i+1] == '\\' {
+                return i + 2
+            }
+        }
+        return 0
+    }
+    if data[1] != '[' {
+        //not a CSI code, just take the escape
+        return 1
+    }
+    for i := 2; i < len(data); i++ {
+        if data[i] >= 0x40 && data[i] <= 0x7e {
+            return i + 1
+        }
+    }
+    return 0
+}
+
+func (screen *Screen) applyEscapeCode(code string) {
+    if strings.HasPrefix(code, OPERATING_SYSTEM_COMMAND_START) {
+        screen.out.WriteString(code)
+        return
+    }
+    if !strings.HasPrefix(code, ESCAPE_CODE_START) {
+        return
+    }
+    params := code[len(ESCAPE_CODE_START):len(code)-1]
+    switch code[len(code)-1] {
+        case 'm':
+            if params == "" || params == "0" {
+                screen.style = ""
+            } else {
+                screen.style += code
+            }
+        case 'H':
+            screen.cursorLineNo, screen.cursorColumn = 1, 1
+            position := strings.Split(params, ";")
+            if lineNo, err := strconv.Atoi(position[0]); err == nil {
+                screen.cursorLineNo = lineNo
+            }
+            if len(position) > 1 {
+                if column, err := strconv.Atoi(position[1]); err == nil {
+                    screen.cursorColumn = column
+                }
+            }
+        case 'K':
+            if screen.cursorLineNo >= 1 && screen.cursorLineNo <= screen.height {
+                line := screen.cells[screen.cursorLineNo-1]
+                //a wide char cleared half of goes too
+                if screen.cursorColumn > 1 && screen.cursorColumn <= screen.width && line[screen.cursorColumn-1].char == WIDE_CHAR_CONTINUATION {
+                    line[screen.cursorColumn-2] = blankCell
+                }
+                for column := screen.cursorColumn; column <= screen.width; column++ {
+                    line[column-1] = blankCell
+                }
+            }
+        case 'J':
+            if params == "2" {
+                screen.cells = newCells(screen.height, screen.width)
+            }
+        default:
+            //modes (e.g. showing the cursor) aren't part of the grid,
+            //they're passed on to the tty as they are
+            screen.out.WriteString(code)
+    }
+}
+
+//Flush writes the cells that changed since the last flush to the tty and
+//puts the tty's cursor where the screen's cursor is
+func (screen *Screen) Flush() {
+    screen.mutex.Lock()
+    defer screen.mutex.Unlock()
+    if screen.isLeft {
+        return
+    }
+    out := screen.out
+    cursorLineNo := minInt(maxInt(screen.cursorLineNo, 1), screen.height)
+    cursorColumn := minInt(maxInt(screen.cursorColumn, 1), screen.width)
+    if out.Buffered() == 0 && !screen.hasChanged() && cursorLineNo == screen.shownCursorLineNo && cursorColumn == screen.shownCursorColumn {
+        return
+    }
+    out.WriteString(HIDE_CURSOR_CODE)
+    if screen.shownCells == nil {
+        out.WriteString(CLEAR_SCREEN_CODE)
+        screen.shownCells = newCells(screen.height, screen.width)
+    }
+    numberOfCellsChanged := 0
+    //where the tty's cursor is and what style it's writing in, -1 if
+    //unknown
+    outLineNo, outColumn := -1, -1
+    outStyle := ""
+    out.WriteString(CANCEL_COLOR_CODE)
+    for i, line := range screen.cells {
+        for j, cell := range line {
+            if cell == screen.shownCells[i][j] {
+                continue
+            }
+            screen.shownCells[i][j] = cell
+            if cell.char == WIDE_CHAR_CONTINUATION {
+                //drawn with the wide char before it, which changed too
+                continue
+            }
+            if outLineNo != i + 1 || outColumn != j + 1 {
+                fmt.Fprintf(out, NAVIGATE_CURSOR_CODE, i + 1, j + 1)
+            }
+            if cell.style != outStyle {
+                out.WriteString(CANCEL_COLOR_CODE)
+                out.WriteString(cell.style)
+                outStyle = cell.style
+            }
+            out.WriteRune(cell.char)
+            out.WriteString(cell.combining)
+            outLineNo, outColumn = i + 1, j + 1 + getRuneWidth(cell.char)
+            numberOfCellsChanged ++
+        }
+    }
+    out.WriteString(CANCEL_COLOR_CODE)
+    fmt.Fprintf(out, NAVIGATE_CURSOR_CODE, cursorLineNo, cursorColumn)
+    screen.shownCursorLineNo, screen.shownCursorColumn = cursorLineNo, cursorColumn
+    out.WriteString(SHOW_CURSOR_CODE)
+    if err := out.Flush(); err != nil {
+        log.Printf("Could not flush screen: %v", err)
+    }
+    log.Printf("Flushed screen, %v cells changed.", numberOfCellsChanged)
+}
+
+//Invalidate makes the next flush redraw every cell, for when something
+//else has drawn on the tty
+func (screen *Screen) Invalidate() {
+    screen.mutex.Lock()
+    defer screen.mutex.Unlock()
+    screen.shownCells = nil
+    screen.isLeft = false
+}
+
+//Resize makes the grid height by width, blank, and the next flush redraw
+//every cell, for when the tty is resized
+func (screen *Screen) Resize(height int, width int) {
+    screen.mutex.Lock()
+    defer screen.mutex.Unlock()
+    screen.height = height
+    screen.width = width
+    screen.cells = newCells(height, width)
+    screen.shownCells = nil
+}
+
+//Leave writes codes (e.g. leaving the alternate screen) straight to the
+//tty, for when it's given back. The cells that changed since the last flush
+//aren't written, so that they aren't drawn over what's left on the tty, and
+//nothing is flushed until Invalidate() - they're drawn then with the rest.
+func (screen *Screen) Leave(codes string) {
+    screen.mutex.Lock()
+    defer screen.mutex.Unlock()
+    screen.isLeft = true
+    screen.out.WriteString(codes)
+    if err := screen.out.Flush(); err != nil {
+        log.Printf("Could not flush screen: %v", err)
+    }
+}
+
+func (screen *Screen) hasChanged() bool {
+    if screen.shownCells == nil {
+        return true
+    }
+    for i, line := range screen.cells {
+        for j, cell := range line {
+            if cell != screen.shownCells[i][j] {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+func maxInt(a int, b int) int {
+    if a > b {
+        return a
+    }
+    return b
+}
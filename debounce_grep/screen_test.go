@@ -0,0 +1,136 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+//cells that changed before the screen was left aren't written until it's
+//drawn again
+func TestScreenLeave(t *testing.T) {
+    var out bytes.Buffer
+    screen := NewScreen(&out, 2, 10)
+    fmt.Fprint(screen, "kafka")
+    screen.Flush()
+    fmt.Fprintf(screen, NAVIGATE_CURSOR_CODE, 2, 1)
+    fmt.Fprint(screen, "rabbit")
+    out.Reset()
+    screen.Leave(LEAVE_ALTERNATE_SCREEN_CODE)
+    screen.Flush()
+    if got := out.String(); got != LEAVE_ALTERNATE_SCREEN_CODE {
+        t.Errorf("got %q written, want only %q", got, LEAVE_ALTERNATE_SCREEN_CODE)
+    }
+    out.Reset()
+    screen.Invalidate()
+    screen.Flush()
+    for _, text := range []string{"kafka", "rabbit"} {
+        if !strings.Contains(out.String(), text) {
+            t.Errorf("got %q written once drawn again, want %q in it", out.String(), text)
+        }
+    }
+}
+
+//getLine returns the chars in the cells of the line at lineNo, with a wide
+//char's second cell as _
+func getLine(screen *Screen, lineNo int) string {
+    var line strings.Builder
+    for _, cell := range screen.cells[lineNo-1] {
+        if cell.char == WIDE_CHAR_CONTINUATION {
+            line.WriteByte('_')
+        } else {
+            line.WriteRune(cell.char)
+            line.WriteString(cell.combining)
+        }
+    }
+    return line.String()
+}
+
+func TestScreenWideChars(t *testing.T) {
+    tests := []struct {
+        name string
+        writes []string
+        want []string
+    }{
+        {"cjk", []string{"卡夫卡 ok"}, []string{"卡_夫_卡_ ok ", "          "}},
+        {"emoji", []string{"a🚀b"}, []string{"a🚀_b      ", "          "}},
+        {"combining", []string{"café"}, []string{"café      ", "          "}},
+        {"combining after a wide char", []string{"卡́"}, []string{"卡́_        ", "          "}},
+        //a wide char doesn't go past the end of a line
+        {"wraps", []string{"abcdefghi卡"}, []string{"abcdefghi ", "卡_        "}},
+        {"over the first half", []string{"卡夫", "\u001b[1;1Hx"}, []string{"x 夫_      ", "          "}},
+        {"over the second half", []string{"卡夫", "\u001b[1;2Hx"}, []string{" x夫_      ", "          "}},
+        {"cleared from the second half", []string{"卡夫", "\u001b[1;4H\u001b[K"}, []string{"卡_        ", "          "}},
+    }
+    for _, test := range tests {
+        var out bytes.Buffer
+        screen := NewScreen(&out, 2, 10)
+        for _, write := range test.writes {
+            fmt.Fprint(screen, write)
+        }
+        for i, want := range test.want {
+            if got := getLine(screen, i + 1); got != want {
+                t.Errorf("%v: got line %v %q, want %q", test.name, i + 1, got, want)
+            }
+        }
+    }
+}
+
+//the tty's cursor is moved past a wide char by drawing it, so the chars
+//after it are drawn without moving it
+func TestScreenFlushWideChars(t *testing.T) {
+    var out bytes.Buffer
+    screen := NewScreen(&out, 1, 10)
+    fmt.Fprint(screen, "abcdefgh")
+    screen.Flush()
+    out.Reset()
+    fmt.Fprint(screen, "\u001b[1;1H卡夫卡-ok")
+    screen.Flush()
+    want := fmt.Sprintf(NAVIGATE_CURSOR_CODE, 1, 1) + "卡夫卡-ok"
+    if !strings.Contains(out.String(), want) {
+        t.Errorf("got %q written, want %q in it", out.String(), want)
+    }
+}
+
+func TestGetStringWidth(t *testing.T) {
+    tests := []struct {
+        s string
+        want int
+    }{
+        {"kafka", 5},
+        {"卡夫卡", 6},
+        {"カフカ", 6},
+        {"ｋａｆｋａ", 10},
+        {"🚀", 2},
+        {"café", 4},
+        {"", 0},
+    }
+    for _, test := range tests {
+        if got := getStringWidth(test.s); got != test.want {
+            t.Errorf("%q: got %v, want %v", test.s, got, test.want)
+        }
+    }
+}
+
+//everything is drawn again after a resize, on a cleared tty
+func TestScreenResize(t *testing.T) {
+    var out bytes.Buffer
+    screen := NewScreen(&out, 2, 10)
+    fmt.Fprint(screen, "kafka")
+    screen.Flush()
+    screen.Resize(3, 20)
+    fmt.Fprintf(screen, NAVIGATE_CURSOR_CODE, 3, 15)
+    fmt.Fprint(screen, "rabbit")
+    out.Reset()
+    screen.Flush()
+    if !strings.HasPrefix(out.String(), HIDE_CURSOR_CODE + CLEAR_SCREEN_CODE) {
+        t.Errorf("got %q written, want the tty cleared first", out.String())
+    }
+    if got := getLine(screen, 3); got != "              rabbit" {
+        t.Errorf("got line 3 %q, want %q", got, "              rabbit")
+    }
+    if got := getLine(screen, 1); got != strings.Repeat(" ", 20) {
+        t.Errorf("got line 1 %q, want it blank", got)
+    }
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+    "log"
+    "sort"
+    "time"
+
+    "debounce_grep/recent"
+)
+
+const (
+    //relevance for fuzzy queries, path otherwise
+    SORT_MODE_AUTO = "auto"
+    SORT_MODE_PATH = "path"
+    SORT_MODE_MATCHES = "matches"
+    SORT_MODE_MTIME = "mtime"
+    SORT_MODE_RELEVANCE = "relevance"
+    //most recently used first, see recordUse()
+    SORT_MODE_RECENT = "recent"
+    //number of files whose last use is kept
+    RECENT_FILES_SIZE = 1000
+)
+
+//order sort modes are gone through with C-o
+var sortModes = []string{SORT_MODE_PATH, SORT_MODE_MATCHES, SORT_MODE_MTIME, SORT_MODE_RELEVANCE, SORT_MODE_RECENT}
+
+func (searchManager *SearchManager) getSortMode() string {
+    if searchManager.sortMode != SORT_MODE_AUTO {
+        return searchManager.sortMode
+    }
+    if searchManager.config.IsFuzzy {
+        return SORT_MODE_RELEVANCE
+    }
+    return SORT_MODE_PATH
+}
+
+func (searchManager *SearchManager) cycleSortMode() {
+    sortMode := searchManager.getSortMode()
+    for i, mode := range sortModes {
+        if mode == sortMode {
+            searchManager.sortMode = sortModes[(i+1) % len(sortModes)]
+            break
+        }
+    }
+    log.Printf("Sort mode changed to %v.", searchManager.sortMode)
+    searchManager.statusMessage = "sorted by " + searchManager.sortMode
+    searchManager.sortFilesWithMatches()
+}
+
+func getFileIsBefore(sortMode string, files []File, recentFiles *recent.Recent) func(i, j int) bool {
+    switch sortMode {
+        case SORT_MODE_MATCHES:
+            return func(i, j int) bool {
+                return files[i].getNumberOfMatches() > files[j].getNumberOfMatches()
+            }
+        case SORT_MODE_MTIME:
+            return func(i, j int) bool {
+                return files[i].modTime.After(files[j].modTime)
+            }
+        case SORT_MODE_RELEVANCE:
+            return func(i, j int) bool {
+                return files[i].relevance > files[j].relevance
+            }
+        case SORT_MODE_RECENT:
+            //looked up once, since files are compared many times
+            usedAt := make(map[string]time.Time)
+            if recentFiles != nil {
+                for _, file := range files {
+                    usedAt[file.path] = recentFiles.UsedAt(file.path)
+                }
+            }
+            return func(i, j int) bool {
+                return usedAt[files[i].path].After(usedAt[files[j].path])
+            }
+    }
+    return func(i, j int) bool {
+        return files[i].path < files[j].path
+    }
+}
+
+//sortFiles sorts filesWithMatches by the current sort mode
+func (searchManager *SearchManager) sortFiles() {
+    files := searchManager.filesWithMatches
+    //stable so that files that are equal stay in walk order
+    sort.SliceStable(files, getFileIsBefore(searchManager.getSortMode(), files, searchManager.recentFiles))
+}
+
+//recordUse records that files were used - opened, accepted, copied or run
+//commands on - now, access times being no use for SORT_MODE_RECENT since
+//searching reads every file
+func (searchManager *SearchManager) recordUse(files []*File) {
+    if searchManager.recentFiles == nil {
+        return
+    }
+    var paths []string
+    for _, file := range files {
+        if !file.source.IsVirtual() {
+            paths = append(paths, file.path)
+        }
+    }
+    if len(paths) == 0 {
+        return
+    }
+    if err := searchManager.recentFiles.Add(paths); err != nil {
+        log.Printf("Could not save recent files: %v", err)
+    }
+}
+
+//sortFilesWithMatches sorts filesWithMatches by the current sort mode,
+//keeping the same file selected and the same files open
+func (searchManager *SearchManager) sortFilesWithMatches() {
+    files := searchManager.filesWithMatches
+    if len(files) == 0 {
+        return
+    }
+    selectedPath := files[searchManager.selectedMatchIndex].path
+    var openPaths []string
+    for _, openFileIndex := range searchManager.openFileIndexQueue {
+        openPaths = append(openPaths, files[openFileIndex].path)
+    }
+
+    searchManager.sortFiles()
+
+    indexOfPath := make(map[string]int)
+    for i, file := range files {
+        indexOfPath[file.path] = i
+    }
+    for i, openPath := range openPaths {
+        searchManager.openFileIndexQueue[i] = indexOfPath[openPath]
+    }
+    //keep selected file on the same line of the tty if it can be
+    searchManager.selectedMatchIndex = indexOfPath[selectedPath]
+    searchManager.scrollToLine(searchManager.cursorLineNo)
+}
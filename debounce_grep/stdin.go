@@ -0,0 +1,62 @@
+package main
+
+import (
+    "io"
+    "log"
+    "os"
+
+    "debounce_grep/search"
+)
+
+const (
+    //what text piped to the program is listed as
+    STDIN_PATH = "(stdin)"
+    //milliseconds between checks of whether what's followed has grown
+    FOLLOW_INTERVAL_MS = 500
+    //milliseconds between looks for new files in the dirs followed, which
+    //walks all of them
+    FOLLOW_NEW_FILES_INTERVAL_MS = 5000
+)
+
+//When text is piped to the program (kubectl logs ... | debounce_grep) it's
+//searched instead of files, as a virtual file read into memory as it comes
+//in. Keys are read from the tty instead of stdin (see getKeyboard()). Each
+//search searches what has been read so far, and with config.Follow, it's
+//searched again whenever more has been read.
+
+//isStdinPiped returns whether stdin is a pipe or a file rather than the tty
+func isStdinPiped() bool {
+    info, err := os.Stdin.Stat()
+    if err != nil {
+        return false
+    }
+    return info.Mode() & os.ModeCharDevice == 0
+}
+
+//readStdin reads stdin into buffer until it ends
+func readStdin(buffer *search.Buffer) {
+    n, err := io.Copy(buffer, os.Stdin)
+    if err != nil {
+        log.Printf("Could not read all of stdin: %v", err)
+    }
+    log.Printf("Read %v bytes from stdin.", n)
+}
+
+func (searchManager *SearchManager) getStdinFile() search.File {
+    return search.NewVirtualFile(STDIN_PATH, searchManager.stdinBuffer)
+}
+
+//searchGrownStdin searches again if stdin has grown since it was last
+//searched
+func (searchManager *SearchManager) searchGrownStdin() {
+    if searchManager.stdinBuffer == nil || len(searchManager.searchTerm) == 0 {
+        return
+    }
+    stdinFile := searchManager.getStdinFile()
+    if stdinFile.Size == searchManager.filesToSearch[0].Size {
+        return
+    }
+    log.Printf("Stdin has grown to %v bytes, searching again.", stdinFile.Size)
+    searchManager.filesToSearch = []search.File{stdinFile}
+    searchManager.searchForMatchesKeepingSelection()
+}
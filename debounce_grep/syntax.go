@@ -0,0 +1,198 @@
+package main
+
+import (
+    "path/filepath"
+    "strings"
+    "unicode"
+)
+
+const (
+    //files bigger than this aren't highlighted, nor are compressed files,
+    //whose size isn't what they decompress to
+    SYNTAX_HIGHLIGHTING_MAX_FILE_SIZE = 1024 * 1024
+)
+
+//Syntax highlighting is deliberately simple: keywords, strings, comments and
+//numbers are colored for a handful of languages, line by line, so comments
+//and strings that span lines are only colored on the line they start on.
+//Matches are highlighted over the syntax colors.
+
+type language struct {
+    name string
+    keywords map[string]bool
+    lineCommentMarkers []string
+    //chars strings can be quoted with
+    stringDelimiters string
+}
+
+func newLanguage(name string, keywords string, lineCommentMarkers []string, stringDelimiters string) *language {
+    language := &language{}
+    language.name = name
+    language.keywords = make(map[string]bool)
+    for _, keyword := range strings.Fields(keywords) {
+        language.keywords[keyword] = true
+    }
+    language.lineCommentMarkers = lineCommentMarkers
+    language.stringDelimiters = stringDelimiters
+    return language
+}
+
+var (
+    languages = map[string]*language{
+        "go": newLanguage("go", "break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false", []string{"//"}, "\"'`"),
+        "python": newLanguage("python", "and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False self", []string{"#"}, "\"'"),
+        "javascript": newLanguage("javascript", "async await break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new of return super switch this throw try typeof var void while with yield null undefined true false interface type enum implements", []string{"//"}, "\"'`"),
+        "shell": newLanguage("shell", "if then else elif fi case esac for while until do done in function return local export readonly set unset shift exit echo", []string{"#"}, "\"'"),
+        "c": newLanguage("c", "auto break case char class const continue default delete do double else enum extern float for goto if inline int long namespace new private protected public register return short signed sizeof static struct switch template this throw try typedef union unsigned using virtual void volatile while bool true false nullptr NULL", []string{"//"}, "\"'"),
+        "java": newLanguage("java", "abstract boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long native new package private protected public return short static super switch synchronized this throw throws try void volatile while null true false var val fun when object", []string{"//"}, "\"'"),
+        "rust": newLanguage("rust", "as async await break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while", []string{"//"}, "\""),
+        "ruby": newLanguage("ruby", "alias and begin break case class def defined do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield", []string{"#"}, "\"'"),
+        "sql": newLanguage("sql", "select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit as distinct null is in like between union SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT AS DISTINCT NULL IS IN LIKE BETWEEN UNION", []string{"--"}, "'\""),
+        "yaml": newLanguage("yaml", "true false null yes no", []string{"#"}, "\"'"),
+    }
+
+    languageOfExtension = map[string]string{
+        ".go": "go",
+        ".py": "python",
+        ".js": "javascript", ".jsx": "javascript", ".ts": "javascript", ".tsx": "javascript", ".mjs": "javascript",
+        ".sh": "shell", ".bash": "shell", ".zsh": "shell",
+        ".c": "c", ".h": "c", ".cc": "c", ".cpp": "c", ".hpp": "c",
+        ".java": "java", ".kt": "java", ".scala": "java", ".cs": "java",
+        ".rs": "rust",
+        ".rb": "ruby",
+        ".sql": "sql",
+        ".yml": "yaml", ".yaml": "yaml",
+    }
+
+    //interpreters in shebangs (#!/usr/bin/env python3) and their languages
+    languageOfInterpreter = map[string]string{
+        "python": "python", "python2": "python", "python3": "python",
+        "sh": "shell", "bash": "shell", "zsh": "shell",
+        "node": "javascript",
+        "ruby": "ruby",
+    }
+)
+
+//detectLanguage detects the language of a file from its extension or, if
+//that doesn't say, the shebang on its first line - nil if it's neither
+func detectLanguage(path string, firstLine string) *language {
+    if name, ok := languageOfExtension[strings.ToLower(filepath.Ext(path))]; ok {
+        return languages[name]
+    }
+    if !strings.HasPrefix(firstLine, "#!") {
+        return nil
+    }
+    fields := strings.Fields(firstLine[2:])
+    if len(fields) == 0 {
+        return nil
+    }
+    interpreter := filepath.Base(fields[0])
+    if interpreter == "env" && len(fields) > 1 {
+        interpreter = fields[1]
+    }
+    return languages[languageOfInterpreter[interpreter]]
+}
+
+//getSyntaxColors returns the color code of each byte of line ("" for
+//bytes that aren't colored)
+func (language *language) getSyntaxColors(line string) []string {
+    colors := make([]string, len(line))
+    for i := 0; i < len(line); {
+        //1) comments take the rest of the line
+        isComment := false
+        for _, marker := range language.lineCommentMarkers {
+            if strings.HasPrefix(line[i:], marker) {
+                isComment = true
+            }
+        }
+        if isComment {
+            setColor(colors, i, len(line), theme.comment)
+            break
+        }
+        //2) strings go until the closing delimiter not escaped by a \
+        if strings.IndexByte(language.stringDelimiters, line[i]) != -1 {
+            end := i + 1
+            for end < len(line) && line[end] != line[i] {
+                if line[end] == '\\' {
+                    end ++
+                }
+                end ++
+            }
+            end = minInt(end + 1, len(line))
+            setColor(colors, i, end, theme.stringLiteral)
+            i = end
+            continue
+        }
+        //3) words are keywords or numbers
+        if isWordChar(line[i]) {
+            end := i
+            for end < len(line) && isWordChar(line[end]) {
+                end ++
+            }
+            word := line[i:end]
+            if language.keywords[word] {
+                setColor(colors, i, end, theme.keyword)
+            } else if unicode.IsDigit(rune(word[0])) {
+                setColor(colors, i, end, theme.number)
+            }
+            i = end
+            continue
+        }
+        i ++
+    }
+    return colors
+}
+
+func setColor(colors []string, start int, end int, colorCode string) {
+    for i := start; i < end; i++ {
+        colors[i] = colorCode
+    }
+}
+
+func isWordChar(char byte) bool {
+    return char == '_' || ('0' <= char && char <= '9') || ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z')
+}
+
+func minInt(a int, b int) int {
+    if a < b {
+        return a
+    }
+    return b
+}
+
+//getCharColorCode returns the color code a char of a line is rendered in:
+//the match color if it's in one of matchIndeces, otherwise its syntax color
+//if any. matchIndexPairIndex is advanced past the matches that end before
+//the char, so chars have to be passed in order.
+func getCharColorCode(charIndex int, matchIndeces [][]int, matchIndexPairIndex *int, syntaxColors []string) string {
+    for *matchIndexPairIndex < len(matchIndeces) && charIndex >= matchIndeces[*matchIndexPairIndex][1] {
+        *matchIndexPairIndex ++
+    }
+    if *matchIndexPairIndex < len(matchIndeces) && charIndex >= matchIndeces[*matchIndexPairIndex][0] {
+        return theme.match
+    }
+    if charIndex < len(syntaxColors) {
+        return syntaxColors[charIndex]
+    }
+    return ""
+}
+
+//getSyntaxColorsOfLine returns the syntax colors of a line of file, or nil
+//if syntax highlighting is off, the file is too big or compressed or its
+//language isn't known
+func (file *File) getSyntaxColorsOfLine(isSyntaxHighlighted bool, line string) []string {
+    if !isSyntaxHighlighted || file.source.Size > SYNTAX_HIGHLIGHTING_MAX_FILE_SIZE {
+        return nil
+    }
+    if !file.isLanguageDetected {
+        if !file.source.IsCompressed() {
+            firstLine, _ := file.source.FirstLine()
+            file.language = detectLanguage(file.path, firstLine)
+        }
+        file.isLanguageDetected = true
+    }
+    if file.language == nil {
+        return nil
+    }
+    return file.language.getSyntaxColors(line)
+}
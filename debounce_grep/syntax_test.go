@@ -0,0 +1,49 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "debounce_grep/internal/testfiles"
+    "debounce_grep/search"
+)
+
+//files too big to highlight quickly aren't highlighted, compressed ones
+//whatever their size on disk is
+func TestGetSyntaxColorsOfLine(t *testing.T) {
+    var compressed bytes.Buffer
+    gzipWriter := gzip.NewWriter(&compressed)
+    gzipWriter.Write([]byte("#!/bin/sh\nif true; then echo a; fi\n"))
+    gzipWriter.Close()
+    dir := testfiles.WriteFiles(t, map[string]string{
+        "run": "#!/bin/sh\nif true; then echo a; fi\n",
+        "big": "#!/bin/sh\n" + strings.Repeat("if true; then echo a; fi\n", SYNTAX_HIGHLIGHTING_MAX_FILE_SIZE / 20),
+    })
+    if err := ioutil.WriteFile(filepath.Join(dir, "run.gz"), compressed.Bytes(), 0644); err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name string
+        isHighlighted bool
+    }{
+        {"run", true},
+        {"big", false},
+        {"run.gz", false},
+    }
+    for _, test := range tests {
+        path := filepath.Join(dir, test.name)
+        info, err := os.Stat(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        file := &File{path: path, source: search.File{Path: path, Root: dir, ModTime: info.ModTime(), Size: info.Size()}}
+        if colors := file.getSyntaxColorsOfLine(true, "if true; then echo a; fi"); (colors != nil) != test.isHighlighted {
+            t.Errorf("%v: got colors %q, want highlighted %v", test.name, colors, test.isHighlighted)
+        }
+    }
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "os/exec"
+    "os/signal"
+    "sync/atomic"
+    "syscall"
+    "time"
+    ut "debounce_grep/utilities"
+)
+
+const (
+    //the TUI is drawn on the alternate screen, so that what was on the tty
+    //before is back when it exits
+    ENTER_ALTERNATE_SCREEN_CODE = "\u001b[?1049h"
+    LEAVE_ALTERNATE_SCREEN_CODE = "\u001b[?1049l"
+    //report presses and releases of buttons and the wheel, in the SGR
+    //format (see parseMouseEvent())
+    ENABLE_MOUSE_TRACKING_CODE = "\u001b[?1000h\u001b[?1006h"
+    DISABLE_MOUSE_TRACKING_CODE = "\u001b[?1006l\u001b[?1000l"
+    //exit code when the program is cancelled instead of accepting a
+    //selection, like a shell's for SIGINT
+    CANCEL_EXIT_CODE = 130
+)
+
+//tty the TUI is drawn on, so that stdout is left for printing what's
+//selected (see accept.go), opened by openTerminal()
+var tty *os.File
+
+//openTerminal opens the tty and makes the screen its size. It's called from
+//main() rather than at init, once logging has been set up.
+func openTerminal() {
+    tty = openTty()
+    ttyHeight, ttyWidth = ut.GetTtyDimensions()
+    screen = NewScreen(tty, ttyHeight, ttyWidth)
+}
+
+func openTty() *os.File {
+    ttyFile, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+    if err != nil {
+        log.Printf("Could not open /dev/tty, drawing on stdout: %v", err)
+        return os.Stdout
+    }
+    return ttyFile
+}
+
+//set while the TUI is suspended for a command (see commands.go), which
+//interrupts are left to
+var isTerminalSuspended int32
+
+//resumeKeyboardChannel is sent to when reading keys is resumed after
+//pauseKeyboard(), buffered so that resuming never blocks
+var resumeKeyboardChannel = make(chan bool, 1)
+
+//getKeyboard returns what keys are read from: the tty, so that reading keys
+//can be paused while a command reads them instead, or stdin if the tty
+//couldn't be opened
+func getKeyboard() *os.File {
+    if tty == os.Stdout {
+        return os.Stdin
+    }
+    return tty
+}
+
+//pauseKeyboard stops keys from being read until resumeKeyboard() by
+//making the read that's waiting for keys (and any after it) time out
+func pauseKeyboard() {
+    if err := getKeyboard().SetReadDeadline(time.Now()); err != nil {
+        log.Printf("Could not pause reading keys: %v", err)
+    }
+}
+
+func resumeKeyboard() {
+    if err := getKeyboard().SetReadDeadline(time.Time{}); err != nil {
+        log.Printf("Could not resume reading keys: %v", err)
+    }
+    select {
+        case resumeKeyboardChannel <- true:
+        default:
+    }
+}
+
+//setUpTerminal puts the tty in the mode keys are read in - a key at a time
+//without echoing them, with enter sent as a carriage return so that it
+//isn't C-j - switches to the alternate screen and turns on mouse tracking
+//if it's enabled. The tty is put back how it was by restoreTerminal(),
+//which is also done if the program is interrupted.
+func setUpTerminal(isMouseEnabled bool) {
+    resumeTerminal(isMouseEnabled)
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+    go func() {
+        for sig := range signals {
+            if atomic.LoadInt32(&isTerminalSuspended) == 1 && sig == syscall.SIGINT {
+                log.Printf("Received %v while suspended, leaving it to the command.", sig)
+                continue
+            }
+            log.Printf("Received %v, exiting.", sig)
+            restoreTerminal(isMouseEnabled)
+            os.Exit(CANCEL_EXIT_CODE)
+        }
+    }()
+}
+
+//resumeTerminal sets up the tty again after restoreTerminal(), redrawing
+//all of the screen
+func resumeTerminal(isMouseEnabled bool) {
+    exec.Command("stty", "-F", "/dev/tty", "cbreak", "min", "1").Run()
+    exec.Command("stty", "-F", "/dev/tty", "-echo", "-icrnl").Run()
+    fmt.Fprint(screen, ENTER_ALTERNATE_SCREEN_CODE)
+    if isMouseEnabled {
+        fmt.Fprint(screen, ENABLE_MOUSE_TRACKING_CODE)
+    }
+    screen.Invalidate()
+    screen.Flush()
+}
+
+//restoreTerminal puts the tty back how it was before setUpTerminal(). It's
+//also called from the goroutine interrupts are handled in, while the main
+//loop may be rendering, which is why the screen is left rather than
+//flushed (see Screen.Leave()).
+func restoreTerminal(isMouseEnabled bool) {
+    codes := LEAVE_ALTERNATE_SCREEN_CODE
+    if isMouseEnabled {
+        codes = DISABLE_MOUSE_TRACKING_CODE + codes
+    }
+    screen.Leave(codes)
+    exec.Command("stty", "-F", "/dev/tty", "icanon", "echo", "icrnl").Run()
+}
+
+//resize lays out and renders everything again for the tty's new size,
+//keeping the selected file in the window
+func (searchManager *SearchManager) resize() {
+    ttyHeight, ttyWidth = ut.GetTtyDimensions()
+    screen.Resize(ttyHeight, ttyWidth)
+    searchManager.updateLayout()
+    searchManager.selectMatch(searchManager.selectedMatchIndex)
+    searchManager.renderSearchTerm()
+    searchManager.renderSearchMatches()
+}
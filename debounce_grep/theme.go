@@ -0,0 +1,200 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+)
+
+const (
+    DEFAULT_COLOR = "default"
+    BRIGHT_COLOR_PREFIX = "bright-"
+    //SGR attributes used instead of colors when colors are disabled
+    BOLD_CODE = "\u001b[1m"
+    DIM_CODE = "\u001b[2m"
+    UNDERLINE_CODE = "\u001b[4m"
+    REVERSE_CODE = "\u001b[7m"
+)
+
+//A theme gives the escape code each part of the UI (role) is rendered
+//with. Colors of roles are the names of the 16 ANSI colors (red,
+//bright-red...), numbers of the 256 colors (208) or truecolor #rrggbb
+//values, which are rendered with the closest of the 256 colors when the
+//terminal doesn't say it supports truecolor. With NO_COLOR set or a dumb
+//terminal, everything is rendered in the default color, with bold,
+//underlines etc. where it's needed to tell things apart.
+
+type Theme struct {
+    selectedFile string
+    markedFile string
+    match string
+    //the search term while typing it and after it has or hasn't matched
+    typing string
+    positive string
+    negative string
+    //a background color
+    scrollBar string
+    lineNumber string
+    keyword string
+    stringLiteral string
+    comment string
+    number string
+}
+
+//names of roles for --color and the theme field each sets
+func (theme *Theme) getRoles() map[string]*string {
+    return map[string]*string{
+        "selected": &theme.selectedFile,
+        "marked": &theme.markedFile,
+        "match": &theme.match,
+        "typing": &theme.typing,
+        "positive": &theme.positive,
+        "negative": &theme.negative,
+        "scrollbar": &theme.scrollBar,
+        "lineno": &theme.lineNumber,
+        "keyword": &theme.keyword,
+        "string": &theme.stringLiteral,
+        "comment": &theme.comment,
+        "number": &theme.number,
+    }
+}
+
+//roles whose colors are background colors
+var backgroundRoles = map[string]bool{"scrollbar": true}
+
+var (
+    themes = map[string]map[string]string{
+        "dark": {
+            "selected": "magenta",
+            "marked": "cyan",
+            "match": "yellow",
+            "typing": "blue",
+            "positive": "green",
+            "negative": "red",
+            "scrollbar": "green",
+            "lineno": DEFAULT_COLOR,
+            "keyword": "blue",
+            "string": "green",
+            "comment": "bright-black",
+            "number": "cyan",
+        },
+        "light": {
+            "selected": "magenta",
+            "marked": "30",
+            "match": "166",
+            "typing": "blue",
+            "positive": "28",
+            "negative": "red",
+            "scrollbar": "black",
+            "lineno": "244",
+            "keyword": "blue",
+            "string": "28",
+            "comment": "244",
+            "number": "30",
+        },
+    }
+
+    monochromeTheme = &Theme{
+        selectedFile: REVERSE_CODE,
+        markedFile: BOLD_CODE,
+        match: BOLD_CODE + UNDERLINE_CODE,
+        positive: BOLD_CODE,
+        negative: DIM_CODE,
+        scrollBar: REVERSE_CODE,
+    }
+
+    ansiColorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+)
+
+//theme everything is rendered with, set in main()
+var theme = monochromeTheme
+
+//NewTheme returns the theme named name with the ROLE=COLOR overrides in
+//colors, or the monochrome theme if isColorDisabled
+func NewTheme(name string, colors []string, isColorDisabled bool, isTrueColorSupported bool) (*Theme, error) {
+    if isColorDisabled {
+        log.Printf("Colors disabled, rendering in monochrome.")
+        return monochromeTheme, nil
+    }
+    colorOfRole := make(map[string]string)
+    for role, color := range themes[name] {
+        colorOfRole[role] = color
+    }
+    for _, override := range colors {
+        i := strings.Index(override, "=")
+        if i == -1 {
+            return nil, fmt.Errorf("invalid color %q: has to be ROLE=COLOR", override)
+        }
+        colorOfRole[override[:i]] = override[i+1:]
+    }
+    theme := &Theme{}
+    roles := theme.getRoles()
+    for role, color := range colorOfRole {
+        target, ok := roles[role]
+        if !ok {
+            return nil, fmt.Errorf("invalid color %q: unknown role %q", role + "=" + color, role)
+        }
+        code, err := getColorCode(color, backgroundRoles[role], isTrueColorSupported)
+        if err != nil {
+            return nil, fmt.Errorf("invalid color for %v: %v", role, err)
+        }
+        *target = code
+    }
+    log.Printf("Using %v theme with overrides %v.", name, colors)
+    return theme, nil
+}
+
+//getColorCode returns the escape code that sets the foreground (or
+//background) to color
+func getColorCode(color string, isBackground bool, isTrueColorSupported bool) (string, error) {
+    //SGR parameters of the 8 colors start from these, and the 256 and
+    //truecolor ones follow these
+    base, extendedBase := 30, 38
+    if isBackground {
+        base, extendedBase = 40, 48
+    }
+    if color == DEFAULT_COLOR {
+        return "", nil
+    }
+    if strings.HasPrefix(color, "#") {
+        if len(color) != 7 {
+            return "", fmt.Errorf("%q has to be #rrggbb", color)
+        }
+        rgb, err := strconv.ParseUint(color[1:], 16, 32)
+        if err != nil {
+            return "", fmt.Errorf("%q has to be #rrggbb", color)
+        }
+        r, g, b := int(rgb >> 16 & 0xff), int(rgb >> 8 & 0xff), int(rgb & 0xff)
+        if !isTrueColorSupported {
+            return fmt.Sprintf("\u001b[%d;5;%dm", extendedBase, getClosest256Color(r, g, b)), nil
+        }
+        return fmt.Sprintf("\u001b[%d;2;%d;%d;%dm", extendedBase, r, g, b), nil
+    }
+    if number, err := strconv.Atoi(color); err == nil {
+        if number < 0 || number > 255 {
+            return "", fmt.Errorf("%v isn't one of the 256 colors (0-255)", number)
+        }
+        return fmt.Sprintf("\u001b[%d;5;%dm", extendedBase, number), nil
+    }
+    //bright colors are 60 after their normal ones
+    name := strings.TrimPrefix(color, BRIGHT_COLOR_PREFIX)
+    if name != color {
+        base += 60
+    }
+    for i, colorName := range ansiColorNames {
+        if colorName == name {
+            return fmt.Sprintf("\u001b[%dm", base + i), nil
+        }
+    }
+    return "", fmt.Errorf("unknown color %q", color)
+}
+
+//getClosest256Color returns the color of the 6x6x6 cube of the 256 colors
+//closest to r, g and b
+func getClosest256Color(r int, g int, b int) int {
+    toCubeIndex := func(value int) int {
+        return (value * 5 + 127) / 255
+    }
+    return 16 + 36 * toCubeIndex(r) + 6 * toCubeIndex(g) + toCubeIndex(b)
+}
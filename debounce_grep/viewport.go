@@ -0,0 +1,157 @@
+package main
+
+//A Viewport lays matched files out in the lines of the tty they're rendered
+//in. Files have different heights - a closed file takes one line, an open
+//one a line for its path, one for each of its lines rendered and one under
+//them - and the window shows the files from top on that fit in it, always
+//including top even if it's taller than the window. It's only layout math,
+//so it knows nothing about files except their heights.
+
+type Viewport struct {
+    //number of lines each file takes up
+    heights []int
+    //lines files can be rendered in
+    numberOfLines int
+    //index of the first file in the window
+    top int
+}
+
+func NewViewport(heights []int, numberOfLines int, top int) *Viewport {
+    viewport := &Viewport{}
+    viewport.heights = heights
+    viewport.numberOfLines = numberOfLines
+    viewport.top = top
+    viewport.clampTop()
+    return viewport
+}
+
+func (viewport *Viewport) clampTop() {
+    if viewport.top >= len(viewport.heights) {
+        viewport.top = len(viewport.heights) - 1
+    }
+    if viewport.top < 0 {
+        viewport.top = 0
+    }
+}
+
+//getLinesBetween returns the lines taken up by the files from start up to
+//but not including end
+func (viewport *Viewport) getLinesBetween(start int, end int) int {
+    lines := 0
+    for i := start; i < end; i++ {
+        lines += viewport.heights[i]
+    }
+    return lines
+}
+
+//getLastVisible returns the index of the last file that fits in the window
+//after the ones before it, -1 if there are no files
+func (viewport *Viewport) getLastVisible() int {
+    if len(viewport.heights) == 0 {
+        return -1
+    }
+    last := viewport.top
+    lines := viewport.heights[last]
+    for last + 1 < len(viewport.heights) && lines + viewport.heights[last+1] <= viewport.numberOfLines {
+        last ++
+        lines += viewport.heights[last]
+    }
+    return last
+}
+
+//scrollTo scrolls the window as little as possible for all of the file at
+//index to be in it - or its start if it's taller than the window
+func (viewport *Viewport) scrollTo(index int) {
+    if index < viewport.top {
+        viewport.top = index
+    }
+    for viewport.top < index && viewport.getLinesBetween(viewport.top, index + 1) > viewport.numberOfLines {
+        viewport.top ++
+    }
+}
+
+//scrollToLine scrolls the window so that the file at index starts
+//linesAbove lines from the top of the window, or as close to that as it can
+//while all of it is in the window
+func (viewport *Viewport) scrollToLine(index int, linesAbove int) {
+    viewport.top = index
+    for viewport.top > 0 && viewport.getLinesBetween(viewport.top - 1, index) <= linesAbove {
+        viewport.top --
+    }
+    viewport.scrollTo(index)
+}
+
+//getIndexLinesAway returns the index of the file that starts about
+//numberOfLines lines below (or above, if negative) the start of the file at
+//index
+func (viewport *Viewport) getIndexLinesAway(index int, numberOfLines int) int {
+    if numberOfLines >= 0 {
+        for index < len(viewport.heights) - 1 && numberOfLines > 0 {
+            numberOfLines -= viewport.heights[index]
+            index ++
+        }
+    } else {
+        for index > 0 && numberOfLines < 0 {
+            index --
+            numberOfLines += viewport.heights[index]
+        }
+    }
+    return index
+}
+
+//getScrollBar returns the line of the window the scroll bar starts on
+//(from 0) and how many lines it is, in proportion to the lines above the
+//window and in it out of the lines of all files - 0 lines if all of them
+//fit in the window
+func (viewport *Viewport) getScrollBar() (int, int) {
+    totalLines := viewport.getLinesBetween(0, len(viewport.heights))
+    if totalLines <= viewport.numberOfLines {
+        return 0, 0
+    }
+    linesAbove := viewport.getLinesBetween(0, viewport.top)
+    linesInWindow := viewport.getLinesBetween(viewport.top, viewport.getLastVisible() + 1)
+    if linesInWindow > viewport.numberOfLines {
+        linesInWindow = viewport.numberOfLines
+    }
+    start := linesAbove * viewport.numberOfLines / totalLines
+    height := (linesInWindow * viewport.numberOfLines + totalLines - 1) / totalLines
+    if height < 1 {
+        height = 1
+    }
+    //the bar reaches the bottom when the last file is in the window
+    if viewport.getLastVisible() == len(viewport.heights) - 1 || start + height > viewport.numberOfLines {
+        start = viewport.numberOfLines - height
+    }
+    return start, height
+}
+
+//getIndexAtLine returns the index of the file rendered on the line of the
+//window linesFromTop lines from its top, -1 if there isn't one
+func (viewport *Viewport) getIndexAtLine(linesFromTop int) int {
+    if linesFromTop < 0 {
+        return -1
+    }
+    lines := 0
+    lastVisible := viewport.getLastVisible()
+    for i := viewport.top; i <= lastVisible && i >= 0; i++ {
+        lines += viewport.heights[i]
+        if linesFromTop < lines {
+            return i
+        }
+    }
+    return -1
+}
+
+//scrollBy scrolls the window numberOfFiles files down (or up, if
+//negative), not past where the last file is at the bottom of the window
+func (viewport *Viewport) scrollBy(numberOfFiles int) {
+    maxTop := len(viewport.heights) - 1
+    for maxTop > 0 && viewport.getLinesBetween(maxTop - 1, len(viewport.heights)) <= viewport.numberOfLines {
+        maxTop --
+    }
+    viewport.top += numberOfFiles
+    if viewport.top > maxTop {
+        viewport.top = maxTop
+    }
+    viewport.clampTop()
+}
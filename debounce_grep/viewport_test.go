@@ -0,0 +1,174 @@
+package main
+
+import (
+    "testing"
+)
+
+//closed files take 1 line, the file at 1 is open with 3 lines rendered and
+//the one at 4 with 1
+var mixedHeights = []int{1, 5, 1, 1, 3, 1}
+
+func TestViewportScrollTo(t *testing.T) {
+    tests := []struct {
+        name string
+        heights []int
+        numberOfLines int
+        top int
+        index int
+        wantTop int
+    }{
+        {"already in window", mixedHeights, 6, 0, 1, 0},
+        {"one line below window", mixedHeights, 6, 0, 2, 1},
+        {"open file below window", mixedHeights, 6, 0, 4, 2},
+        {"bottom edge", mixedHeights, 6, 0, 5, 2},
+        {"above window", mixedHeights, 6, 3, 1, 1},
+        {"top edge", mixedHeights, 6, 2, 0, 0},
+        {"file taller than window", []int{1, 10, 1}, 4, 0, 1, 1},
+        {"after file taller than window", []int{1, 10, 1}, 4, 1, 2, 2},
+    }
+    for _, test := range tests {
+        viewport := NewViewport(test.heights, test.numberOfLines, test.top)
+        viewport.scrollTo(test.index)
+        if viewport.top != test.wantTop {
+            t.Errorf("%v: scrollTo(%v) from %v scrolled to %v, want %v", test.name, test.index, test.top, viewport.top, test.wantTop)
+        }
+    }
+}
+
+func TestViewportScrollToLine(t *testing.T) {
+    tests := []struct {
+        name string
+        index int
+        linesAbove int
+        wantTop int
+    }{
+        {"keeps lines above", 3, 2, 2},
+        {"open file doesn't fit above", 3, 5, 2},
+        {"open file fits above", 2, 5, 1},
+        {"not past the top", 1, 10, 0},
+        {"has to fit in the window", 4, 10, 2},
+        {"top of window", 4, 0, 4},
+    }
+    for _, test := range tests {
+        viewport := NewViewport(mixedHeights, 6, 0)
+        viewport.scrollToLine(test.index, test.linesAbove)
+        if viewport.top != test.wantTop {
+            t.Errorf("%v: scrollToLine(%v, %v) scrolled to %v, want %v", test.name, test.index, test.linesAbove, viewport.top, test.wantTop)
+        }
+    }
+}
+
+func TestViewportGetIndexLinesAway(t *testing.T) {
+    tests := []struct {
+        index int
+        numberOfLines int
+        want int
+    }{
+        {0, 0, 0},
+        {0, 1, 1},
+        //past the open file
+        {0, 3, 2},
+        {4, -2, 2},
+        {2, -1, 1},
+        {5, 100, 5},
+        {1, -100, 0},
+    }
+    viewport := NewViewport(mixedHeights, 6, 0)
+    for _, test := range tests {
+        if got := viewport.getIndexLinesAway(test.index, test.numberOfLines); got != test.want {
+            t.Errorf("getIndexLinesAway(%v, %v) = %v, want %v", test.index, test.numberOfLines, got, test.want)
+        }
+    }
+}
+
+func TestViewportGetScrollBar(t *testing.T) {
+    ones := make([]int, 100)
+    for i := range ones {
+        ones[i] = 1
+    }
+    tests := []struct {
+        name string
+        heights []int
+        numberOfLines int
+        top int
+        wantStart int
+        wantHeight int
+    }{
+        {"all files fit", []int{1, 1}, 6, 0, 0, 0},
+        {"no files", nil, 6, 0, 0, 0},
+        //6 of 12 lines in the window
+        {"at the top", mixedHeights, 6, 0, 0, 3},
+        {"at the bottom", mixedHeights, 6, 2, 3, 3},
+        {"in the middle", ones, 10, 45, 4, 1},
+        {"reaches the bottom", ones, 10, 90, 9, 1},
+        //only the window's worth of a file taller than it counts
+        {"file taller than window", []int{1, 20, 1}, 4, 1, 0, 1},
+    }
+    for _, test := range tests {
+        viewport := NewViewport(test.heights, test.numberOfLines, test.top)
+        start, height := viewport.getScrollBar()
+        if start != test.wantStart || height != test.wantHeight {
+            t.Errorf("%v: got scroll bar at %v of height %v, want at %v of height %v", test.name, start, height, test.wantStart, test.wantHeight)
+        }
+        if height > 0 && (start < 0 || start + height > test.numberOfLines) {
+            t.Errorf("%v: scroll bar at %v of height %v is outside the window of %v lines", test.name, start, height, test.numberOfLines)
+        }
+    }
+}
+
+func TestViewportGetIndexAtLine(t *testing.T) {
+    tests := []struct {
+        top int
+        linesFromTop int
+        want int
+    }{
+        {0, 0, 0},
+        {0, 1, 1},
+        {0, 5, 1},
+        //file 2 doesn't fit in the window
+        {0, 6, -1},
+        {0, -1, -1},
+        {2, 0, 2},
+        {2, 1, 3},
+        {2, 2, 4},
+        {2, 4, 4},
+        {2, 5, 5},
+        {2, 6, -1},
+    }
+    for _, test := range tests {
+        viewport := NewViewport(mixedHeights, 6, test.top)
+        if got := viewport.getIndexAtLine(test.linesFromTop); got != test.want {
+            t.Errorf("getIndexAtLine(%v) from %v = %v, want %v", test.linesFromTop, test.top, got, test.want)
+        }
+    }
+    if got := NewViewport(nil, 6, 0).getIndexAtLine(0); got != -1 {
+        t.Errorf("getIndexAtLine(0) with no files = %v, want -1", got)
+    }
+}
+
+func TestViewportScrollBy(t *testing.T) {
+    tests := []struct {
+        top int
+        numberOfFiles int
+        wantTop int
+    }{
+        {0, 1, 1},
+        //the last file is at the bottom of the window from 2 on
+        {0, 10, 2},
+        {2, 1, 2},
+        {2, -1, 1},
+        {1, -5, 0},
+    }
+    for _, test := range tests {
+        viewport := NewViewport(mixedHeights, 6, test.top)
+        viewport.scrollBy(test.numberOfFiles)
+        if viewport.top != test.wantTop {
+            t.Errorf("scrollBy(%v) from %v scrolled to %v, want %v", test.numberOfFiles, test.top, viewport.top, test.wantTop)
+        }
+    }
+    viewport := NewViewport(nil, 6, 0)
+    viewport.scrollBy(1)
+    if viewport.top != 0 {
+        t.Errorf("scrollBy(1) with no files scrolled to %v, want 0", viewport.top)
+    }
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+    "sort"
+    "unicode"
+)
+
+//Wide chars (CJK, most emoji) take 2 cells of the tty and combining marks
+//take none, like go-runewidth and wcwidth() count them. Chars with an
+//ambiguous width are counted as 1 cell, like most terminals show them
+//outside of CJK locales.
+
+//ranges of chars that are 2 cells wide, in order, from the wide and
+//fullwidth chars of Unicode's East Asian Width property
+var wideRanges = [][2]rune{
+    {0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+    {0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+    {0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+    {0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+    {0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+    {0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+    {0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+    {0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+    {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e},
+    {0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+    {0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19},
+    {0xfe30, 0xfe6f}, {0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x16fe0, 0x16fe4},
+    {0x17000, 0x18aff}, {0x1b000, 0x1b2ff}, {0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf},
+    {0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f200, 0x1f251}, {0x1f300, 0x1f64f},
+    {0x1f680, 0x1f6ff}, {0x1f7e0, 0x1f7eb}, {0x1f90c, 0x1f9ff}, {0x1fa70, 0x1faff},
+    {0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+//getRuneWidth returns how many cells of the tty char takes
+func getRuneWidth(char rune) int {
+    if unicode.In(char, unicode.Mn, unicode.Me) || char == 0x200b || char == 0x200d || char == 0xfeff {
+        return 0
+    }
+    if char < wideRanges[0][0] {
+        return 1
+    }
+    i := sort.Search(len(wideRanges), func(i int) bool {
+        return wideRanges[i][1] >= char
+    })
+    if i < len(wideRanges) && wideRanges[i][0] <= char {
+        return 2
+    }
+    return 1
+}
+
+//getStringWidth returns how many cells of the tty s takes, s having no
+//escape codes
+func getStringWidth(s string) int {
+    width := 0
+    for _, char := range s {
+        width += getRuneWidth(char)
+    }
+    return width
+}
@@ -0,0 +1,132 @@
+//Package history keeps the queries that have been searched for across
+//sessions, stored one per line in a file with the most recent query last.
+package history
+
+import (
+    "bufio"
+    "io/ioutil"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+const HISTORY_FILE_NAME = "history"
+
+type History struct {
+    path string
+    maxSize int
+    //oldest query first
+    entries []string
+}
+
+//New returns a History saved to path that keeps at most maxSize queries.
+//Nothing is read from path until Load() is called.
+func New(path string, maxSize int) *History {
+    history := &History{}
+    history.path = path
+    history.maxSize = maxSize
+    history.entries = make([]string, 0)
+    return history
+}
+
+//Load reads the queries saved to the history file, a missing file just
+//being an empty history
+func (history *History) Load() error {
+    f, err := os.Open(history.path)
+    if os.IsNotExist(err) {
+        log.Printf("No history file at %v.", history.path)
+        return nil
+    } else if err != nil {
+        return err
+    }
+    defer f.Close()
+    entries := make([]string, 0)
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        if len(scanner.Text()) > 0 {
+            entries = append(entries, scanner.Text())
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    history.entries = entries
+    history.truncate()
+    log.Printf("Loaded %v queries from history file %v.", len(history.entries), history.path)
+    return nil
+}
+
+//Entries returns the queries in the history, oldest first
+func (history *History) Entries() []string {
+    return history.entries
+}
+
+//Add makes query the most recent entry, removing any earlier occurrence of
+//it, and saves the history
+func (history *History) Add(query string) error {
+    if len(query) == 0 || strings.Contains(query, "\n") {
+        return nil
+    }
+    history.remove(query)
+    history.entries = append(history.entries, query)
+    history.truncate()
+    return history.save()
+}
+
+func (history *History) remove(query string) {
+    for i, entry := range history.entries {
+        if entry == query {
+            history.entries = append(history.entries[:i], history.entries[i+1:]...)
+            return
+        }
+    }
+}
+
+func (history *History) truncate() {
+    if len(history.entries) > history.maxSize {
+        history.entries = history.entries[len(history.entries)-history.maxSize:]
+    }
+}
+
+func (history *History) save() error {
+    //write to a temp file and rename it over the history file so that
+    //a crash part way through writing doesn't lose the history
+    dir := filepath.Dir(history.path)
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+    f, err := ioutil.TempFile(dir, HISTORY_FILE_NAME)
+    if err != nil {
+        return err
+    }
+    w := bufio.NewWriter(f)
+    for _, entry := range history.entries {
+        w.WriteString(entry)
+        w.WriteString("\n")
+    }
+    if err := w.Flush(); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(f.Name())
+        return err
+    }
+    return os.Rename(f.Name(), history.path)
+}
+
+//SearchBackwards returns the index of the newest entry at or before index
+//start that contains query, or -1 if there isn't one
+func (history *History) SearchBackwards(query string, start int) int {
+    if start >= len(history.entries) {
+        start = len(history.entries) - 1
+    }
+    for i := start; i >= 0; i-- {
+        if strings.Contains(history.entries[i], query) {
+            return i
+        }
+    }
+    return -1
+}
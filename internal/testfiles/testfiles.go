@@ -0,0 +1,96 @@
+//Package testfiles writes the files the tests of the other packages search,
+//and generates a corpus of notes for them to test and benchmark searching
+//with.
+package testfiles
+
+import (
+    "fmt"
+    "io/ioutil"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+//words most of the corpus is made of
+var words = []string{"the", "meeting", "notes", "about", "and", "with", "from", "we", "discussed", "next", "steps", "for", "team", "project", "deadline", "review"}
+
+//Topics are what's searched for in the corpus. Each is in about a third of
+//the files, so that queries of more of them match fewer files.
+var Topics = []string{"kafka", "retention", "consumer group", "offset", "rabbit", "draft"}
+
+//NewDir returns a new temp dir, which is removed when the test ends
+func NewDir(t testing.TB) string {
+    dir, err := ioutil.TempDir("", "debounce_grep_test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        os.RemoveAll(dir)
+    })
+    return dir
+}
+
+//Write writes files (path relative to dir to content) under dir
+func Write(t testing.TB, dir string, files map[string]string) {
+    for path, content := range files {
+        fullPath := filepath.Join(dir, path)
+        if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := ioutil.WriteFile(fullPath, []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+//WriteFiles writes files (relative path to content) under a new temp dir
+//and returns the dir, which is removed when the test ends
+func WriteFiles(t testing.TB, files map[string]string) string {
+    dir := NewDir(t)
+    Write(t, dir, files)
+    return dir
+}
+
+//GetCorpus returns numberOfFiles files of random notes (relative path to
+//content), the same ones every time, with headings, \r\n line endings and
+//a file not ending in a line break here and there
+func GetCorpus(numberOfFiles int) map[string]string {
+    random := rand.New(rand.NewSource(1))
+    corpus := make(map[string]string)
+    for i := 0; i < numberOfFiles; i++ {
+        var fileTopics []string
+        for _, topic := range Topics {
+            if random.Intn(3) == 0 {
+                fileTopics = append(fileTopics, topic)
+            }
+        }
+        var builder strings.Builder
+        numberOfLines := 50 + random.Intn(400)
+        for j := 0; j < numberOfLines; j++ {
+            if random.Intn(40) == 0 {
+                builder.WriteString("# ")
+            }
+            numberOfWords := 4 + random.Intn(12)
+            for k := 0; k < numberOfWords; k++ {
+                if k > 0 {
+                    builder.WriteByte(' ')
+                }
+                if len(fileTopics) > 0 && random.Intn(30) == 0 {
+                    builder.WriteString(fileTopics[random.Intn(len(fileTopics))])
+                } else {
+                    builder.WriteString(words[random.Intn(len(words))])
+                }
+            }
+            if i % 10 == 0 {
+                builder.WriteByte('\r')
+            }
+            if j < numberOfLines - 1 || i % 2 == 0 {
+                builder.WriteByte('\n')
+            }
+        }
+        corpus[fmt.Sprintf("note%v.md", i)] = builder.String()
+    }
+    return corpus
+}
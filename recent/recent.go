@@ -0,0 +1,150 @@
+//Package recent keeps when files were last used - opened, accepted, copied
+//or run commands on - across sessions, so that files can be sorted by how
+//recently they were used rather than by their access times, which
+//searching updates (or, with noatime, nothing does). Uses are stored one
+//per line as the unix time in nanoseconds, a tab and the file's absolute
+//path, the most recently used file last.
+package recent
+
+import (
+    "bufio"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const RECENT_FILE_NAME = "recent"
+
+type Recent struct {
+    path string
+    maxSize int
+    //by absolute path
+    usedAt map[string]time.Time
+}
+
+//New returns a Recent saved to path that keeps at most maxSize files.
+//Nothing is read from path until Load() is called.
+func New(path string, maxSize int) *Recent {
+    recent := &Recent{}
+    recent.path = path
+    recent.maxSize = maxSize
+    recent.usedAt = make(map[string]time.Time)
+    return recent
+}
+
+//Load reads the uses saved to the file, a missing file meaning no file has
+//been used
+func (recent *Recent) Load() error {
+    f, err := os.Open(recent.path)
+    if os.IsNotExist(err) {
+        log.Printf("No recent files file at %v.", recent.path)
+        return nil
+    } else if err != nil {
+        return err
+    }
+    defer f.Close()
+    usedAt := make(map[string]time.Time)
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        fields := strings.SplitN(scanner.Text(), "\t", 2)
+        if len(fields) != 2 {
+            continue
+        }
+        nanoseconds, err := strconv.ParseInt(fields[0], 10, 64)
+        if err != nil {
+            continue
+        }
+        usedAt[fields[1]] = time.Unix(0, nanoseconds)
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    recent.usedAt = usedAt
+    recent.truncate()
+    log.Printf("Loaded %v recent files from %v.", len(recent.usedAt), recent.path)
+    return nil
+}
+
+//UsedAt returns when the file at path was last used, the zero time if it
+//hasn't been
+func (recent *Recent) UsedAt(path string) time.Time {
+    return recent.usedAt[getAbsolutePath(path)]
+}
+
+//Add records that the files at paths were used now and saves the uses
+func (recent *Recent) Add(paths []string) error {
+    now := time.Now()
+    for _, path := range paths {
+        if strings.Contains(path, "\n") {
+            continue
+        }
+        recent.usedAt[getAbsolutePath(path)] = now
+    }
+    recent.truncate()
+    return recent.save()
+}
+
+func getAbsolutePath(path string) string {
+    if absolutePath, err := filepath.Abs(path); err == nil {
+        return absolutePath
+    }
+    return path
+}
+
+//getPaths returns the paths of the files used, least recently used first
+func (recent *Recent) getPaths() []string {
+    paths := make([]string, 0, len(recent.usedAt))
+    for path := range recent.usedAt {
+        paths = append(paths, path)
+    }
+    sort.Slice(paths, func(i, j int) bool {
+        if !recent.usedAt[paths[i]].Equal(recent.usedAt[paths[j]]) {
+            return recent.usedAt[paths[i]].Before(recent.usedAt[paths[j]])
+        }
+        return paths[i] < paths[j]
+    })
+    return paths
+}
+
+//truncate forgets the least recently used files past maxSize
+func (recent *Recent) truncate() {
+    if len(recent.usedAt) <= recent.maxSize {
+        return
+    }
+    paths := recent.getPaths()
+    for _, path := range paths[:len(paths)-recent.maxSize] {
+        delete(recent.usedAt, path)
+    }
+}
+
+func (recent *Recent) save() error {
+    //written to a temp file that's renamed over the file, like the history
+    dir := filepath.Dir(recent.path)
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+    f, err := ioutil.TempFile(dir, RECENT_FILE_NAME)
+    if err != nil {
+        return err
+    }
+    w := bufio.NewWriter(f)
+    for _, path := range recent.getPaths() {
+        fmt.Fprintf(w, "%v\t%v\n", recent.usedAt[path].UnixNano(), path)
+    }
+    if err := w.Flush(); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(f.Name())
+        return err
+    }
+    return os.Rename(f.Name(), recent.path)
+}
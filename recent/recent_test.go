@@ -0,0 +1,45 @@
+package recent
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestRecent(t *testing.T) {
+    dir, err := ioutil.TempDir("", "recent_test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "data", RECENT_FILE_NAME)
+    recent := New(path, 2)
+    if err := recent.Load(); err != nil {
+        t.Fatal(err)
+    }
+    for _, paths := range [][]string{{"kafka.md"}, {"rabbit.md", "notes/zookeeper.md"}, {"kafka.md"}} {
+        if err := recent.Add(paths); err != nil {
+            t.Fatal(err)
+        }
+    }
+    loaded := New(path, 2)
+    if err := loaded.Load(); err != nil {
+        t.Fatal(err)
+    }
+    absolutePath, _ := filepath.Abs("kafka.md")
+    if !loaded.UsedAt(absolutePath).Equal(recent.UsedAt("kafka.md")) || loaded.UsedAt("kafka.md").IsZero() {
+        t.Errorf("got kafka.md used at %v, want %v", loaded.UsedAt("kafka.md"), recent.UsedAt("kafka.md"))
+    }
+    //only 2 are kept, files used at the same time being forgotten in order
+    //of path
+    if !loaded.UsedAt("notes/zookeeper.md").IsZero() {
+        t.Errorf("got notes/zookeeper.md used at %v, want it forgotten", loaded.UsedAt("notes/zookeeper.md"))
+    }
+    if !loaded.UsedAt("rabbit.md").Equal(recent.UsedAt("rabbit.md")) || loaded.UsedAt("rabbit.md").IsZero() {
+        t.Errorf("got rabbit.md used at %v, want %v", loaded.UsedAt("rabbit.md"), recent.UsedAt("rabbit.md"))
+    }
+    if !loaded.UsedAt("never.md").IsZero() {
+        t.Errorf("got never.md used at %v, want never", loaded.UsedAt("never.md"))
+    }
+}
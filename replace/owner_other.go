@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package replace
+
+import (
+    "os"
+)
+
+//owners aren't kept on other platforms
+func keepOwner(f *os.File, info os.FileInfo) {
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package replace
+
+import (
+    "log"
+    "os"
+    "syscall"
+)
+
+//keepOwner gives f the owner and group of the file info is of, which only
+//works for the file's owner's own groups unless running as root
+func keepOwner(f *os.File, info os.FileInfo) {
+    stat, ok := info.Sys().(*syscall.Stat_t)
+    if !ok {
+        return
+    }
+    if err := f.Chown(int(stat.Uid), int(stat.Gid)); err != nil {
+        log.Printf("Could not keep the owner of %v: %v", info.Name(), err)
+    }
+}
@@ -0,0 +1,35 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package replace
+
+import (
+    "os"
+    "path/filepath"
+    "syscall"
+    "testing"
+
+    "debounce_grep/internal/testfiles"
+)
+
+func TestWriteFileAtomicallyKeepsOwner(t *testing.T) {
+    if os.Getuid() != 0 {
+        t.Skip("only root can give files to other users")
+    }
+    path := filepath.Join(testfiles.NewDir(t), "notes.md")
+    writeFile(t, path, "kafka\n", 0644)
+    if err := os.Chown(path, 1234, 5678); err != nil {
+        t.Fatal(err)
+    }
+    if err := WriteFileAtomically(path, []byte("rabbit\n")); err != nil {
+        t.Fatal(err)
+    }
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    stat := info.Sys().(*syscall.Stat_t)
+    if stat.Uid != 1234 || stat.Gid != 5678 {
+        t.Errorf("got owner %v:%v, want 1234:5678", stat.Uid, stat.Gid)
+    }
+}
@@ -0,0 +1,221 @@
+//Package replace writes changes to lines of files, each file being written
+//to a temp file that's renamed over it so that it's never left half
+//written, and keeps a journal of the last changes written so that they
+//can be undone.
+package replace
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+const JOURNAL_FILE_NAME = "replace_journal.json"
+
+//Change replaces the text of the line LineNo (from 1) of the file at Path,
+//without its line ending, from Old to New
+type Change struct {
+    Path string
+    LineNo int
+    Old string
+    New string
+}
+
+//GetChange returns the change replacing pattern with replacement in text,
+//the text of line lineNo of the file at path, with $1, ${2}, ${name} etc. in
+//replacement expanded to what pattern's groups matched like
+//regexp.Expand(). ok is false if replacing doesn't change text.
+func GetChange(path string, lineNo int, text string, pattern *regexp.Regexp, replacement string) (Change, bool) {
+    newText := pattern.ReplaceAllString(text, replacement)
+    if newText == text {
+        return Change{}, false
+    }
+    return Change{Path: path, LineNo: lineNo, Old: text, New: newText}, true
+}
+
+//Apply writes changes to their files, leaving alone files whose lines
+//aren't what the changes expect them to be (e.g. if they were edited since
+//they were searched). It returns the changes that were written and an
+//error for the first file that couldn't be.
+func Apply(changes []Change) ([]Change, error) {
+    var applied []Change
+    var firstErr error
+    for _, fileChanges := range groupByPath(changes) {
+        if err := applyToFile(fileChanges); err != nil {
+            log.Printf("Could not apply %v changes to %v: %v", len(fileChanges), fileChanges[0].Path, err)
+            if firstErr == nil {
+                firstErr = err
+            }
+            continue
+        }
+        applied = append(applied, fileChanges...)
+    }
+    log.Printf("Applied %v of %v changes.", len(applied), len(changes))
+    return applied, firstErr
+}
+
+//Reverse returns changes that undo changes
+func Reverse(changes []Change) []Change {
+    reversed := make([]Change, len(changes))
+    for i, change := range changes {
+        reversed[i] = Change{Path: change.Path, LineNo: change.LineNo, Old: change.New, New: change.Old}
+    }
+    return reversed
+}
+
+//groupByPath groups changes by the file they're to, in order of path
+func groupByPath(changes []Change) [][]Change {
+    changesOfPath := make(map[string][]Change)
+    var paths []string
+    for _, change := range changes {
+        if _, ok := changesOfPath[change.Path]; !ok {
+            paths = append(paths, change.Path)
+        }
+        changesOfPath[change.Path] = append(changesOfPath[change.Path], change)
+    }
+    sort.Strings(paths)
+    var groups [][]Change
+    for _, path := range paths {
+        groups = append(groups, changesOfPath[path])
+    }
+    return groups
+}
+
+func applyToFile(changes []Change) error {
+    path := changes[0].Path
+    content, err := ioutil.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    //line endings (\n or \r\n) are kept as they are
+    lines := strings.SplitAfter(string(content), "\n")
+    for _, change := range changes {
+        if change.LineNo < 1 || change.LineNo > len(lines) {
+            return fmt.Errorf("%v has no line %v", path, change.LineNo)
+        }
+        line := lines[change.LineNo-1]
+        text := strings.TrimRight(line, "\r\n")
+        if text != change.Old {
+            return fmt.Errorf("line %v of %v has changed since it was searched", change.LineNo, path)
+        }
+        lines[change.LineNo-1] = change.New + line[len(text):]
+    }
+    return WriteFileAtomically(path, []byte(strings.Join(lines, "")))
+}
+
+//WriteFileAtomically replaces the contents of the file at path with data
+//by writing data to a temp file in the same directory and renaming it over
+//the file, keeping the file's permissions and, where the platform and the
+//user's privileges allow, its owner and group if it exists. A file that
+//can't be given back its owner (e.g. another user's file that's writable
+//by the group) ends up owned by the user.
+func WriteFileAtomically(path string, data []byte) error {
+    //write the file a symlink points to rather than replacing the symlink
+    if resolvedPath, err := filepath.EvalSymlinks(path); err == nil {
+        path = resolvedPath
+    }
+    mode := os.FileMode(0644)
+    info, err := os.Stat(path)
+    if err == nil {
+        mode = info.Mode().Perm()
+    } else if !os.IsNotExist(err) {
+        return err
+    }
+    f, err := ioutil.TempFile(filepath.Dir(path), "." + filepath.Base(path) + ".")
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(data); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return err
+    }
+    //before the mode, since changing the owner can clear setuid bits
+    if info != nil {
+        keepOwner(f, info)
+    }
+    if err := f.Chmod(mode); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return err
+    }
+    if err := f.Sync(); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(f.Name())
+        return err
+    }
+    return os.Rename(f.Name(), path)
+}
+
+//Journal keeps the changes of the last replace that was written
+type Journal struct {
+    path string
+}
+
+func NewJournal(path string) *Journal {
+    journal := &Journal{}
+    journal.path = path
+    return journal
+}
+
+//Save replaces the changes in the journal with changes
+func (journal *Journal) Save(changes []Change) error {
+    data, err := json.Marshal(changes)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(journal.path), 0755); err != nil {
+        return err
+    }
+    return WriteFileAtomically(journal.path, data)
+}
+
+//Load returns the changes in the journal, none if there's no journal
+func (journal *Journal) Load() ([]Change, error) {
+    data, err := ioutil.ReadFile(journal.path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    } else if err != nil {
+        return nil, err
+    }
+    var changes []Change
+    if err := json.Unmarshal(data, &changes); err != nil {
+        return nil, fmt.Errorf("could not read replace journal %v: %v", journal.path, err)
+    }
+    return changes, nil
+}
+
+//Undo reverts the changes in the journal and empties it, returning the
+//changes that were reverted. Changes to files that have been edited since
+//are left alone, and stay in the journal.
+func (journal *Journal) Undo() ([]Change, error) {
+    changes, err := journal.Load()
+    if err != nil || len(changes) == 0 {
+        return nil, err
+    }
+    reverted, applyErr := Apply(Reverse(changes))
+    isReverted := make(map[string]bool)
+    for _, change := range reverted {
+        isReverted[change.Path] = true
+    }
+    var left []Change
+    for _, change := range changes {
+        if !isReverted[change.Path] {
+            left = append(left, change)
+        }
+    }
+    if err := journal.Save(left); err != nil {
+        return Reverse(reverted), err
+    }
+    return Reverse(reverted), applyErr
+}
@@ -0,0 +1,278 @@
+package replace
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "reflect"
+    "regexp"
+    "testing"
+
+    "debounce_grep/internal/testfiles"
+)
+
+func writeFile(t *testing.T, path string, content string, mode os.FileMode) {
+    if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+        t.Fatal(err)
+    }
+    //in case the umask took bits away
+    if err := os.Chmod(path, mode); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func readFile(t *testing.T, path string) string {
+    content, err := ioutil.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(content)
+}
+
+func TestGetChange(t *testing.T) {
+    tests := []struct {
+        pattern string
+        replacement string
+        text string
+        want string
+        wantOk bool
+    }{
+        {"kafka", "rabbit", "kafka and kafka", "rabbit and rabbit", true},
+        {"(\\w+)@(\\w+)", "$2 at $1", "me@home", "home at me", true},
+        {"(\\w+)@(\\w+)", "${2}_$1", "me@home", "home_me", true},
+        {"(?P<user>\\w+)@\\w+", "${user}", "me@home", "me", true},
+        //$1x is the group named 1x, which there isn't
+        {"(\\w+)@", "$1x", "me@home", "home", true},
+        {"\\$", "$$", "costs $5", "costs $5", false},
+        {"nowhere", "x", "kafka", "", false},
+    }
+    for _, test := range tests {
+        change, ok := GetChange("notes.md", 3, test.text, regexp.MustCompile(test.pattern), test.replacement)
+        if ok != test.wantOk {
+            t.Errorf("replacing %q with %q in %q: got ok %v, want %v", test.pattern, test.replacement, test.text, ok, test.wantOk)
+            continue
+        }
+        want := Change{}
+        if test.wantOk {
+            want = Change{Path: "notes.md", LineNo: 3, Old: test.text, New: test.want}
+        }
+        if change != want {
+            t.Errorf("replacing %q with %q in %q: got %+v, want %+v", test.pattern, test.replacement, test.text, change, want)
+        }
+    }
+}
+
+func TestApply(t *testing.T) {
+    tests := []struct {
+        name string
+        content string
+        changes []Change
+        want string
+        wantErr bool
+    }{
+        {
+            name: "lf",
+            content: "kafka\nretention\n",
+            changes: []Change{{LineNo: 2, Old: "retention", New: "compaction"}},
+            want: "kafka\ncompaction\n",
+        },
+        {
+            name: "crlf is kept",
+            content: "kafka\r\nretention\r\nlag",
+            changes: []Change{{LineNo: 1, Old: "kafka", New: "rabbit"}, {LineNo: 3, Old: "lag", New: "offset"}},
+            want: "rabbit\r\nretention\r\noffset",
+        },
+        {
+            name: "mixed line endings are kept",
+            content: "kafka\r\nkafka\n",
+            changes: []Change{{LineNo: 1, Old: "kafka", New: "a"}, {LineNo: 2, Old: "kafka", New: "b"}},
+            want: "a\r\nb\n",
+        },
+        {
+            name: "edited since searched",
+            content: "kafka\nretention is 7 days\n",
+            changes: []Change{{LineNo: 1, Old: "kafka", New: "rabbit"}, {LineNo: 2, Old: "retention", New: "compaction"}},
+            want: "kafka\nretention is 7 days\n",
+            wantErr: true,
+        },
+        {
+            name: "line no longer there",
+            content: "kafka\n",
+            changes: []Change{{LineNo: 3, Old: "kafka", New: "rabbit"}},
+            want: "kafka\n",
+            wantErr: true,
+        },
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            path := filepath.Join(testfiles.NewDir(t), "notes.md")
+            writeFile(t, path, test.content, 0644)
+            changes := make([]Change, len(test.changes))
+            for i, change := range test.changes {
+                change.Path = path
+                changes[i] = change
+            }
+            applied, err := Apply(changes)
+            if (err != nil) != test.wantErr {
+                t.Errorf("got error %v, want an error: %v", err, test.wantErr)
+            }
+            if test.wantErr && len(applied) > 0 {
+                t.Errorf("got %v changes applied, want none", len(applied))
+            }
+            if got := readFile(t, path); got != test.want {
+                t.Errorf("got %q, want %q", got, test.want)
+            }
+        })
+    }
+}
+
+//a file that can't be changed doesn't keep the others from being
+func TestApplyToSomeFiles(t *testing.T) {
+    dir := testfiles.NewDir(t)
+    changedPath := filepath.Join(dir, "changed.md")
+    editedPath := filepath.Join(dir, "edited.md")
+    writeFile(t, changedPath, "kafka\n", 0644)
+    writeFile(t, editedPath, "kafka streams\n", 0644)
+    changes := []Change{
+        {Path: editedPath, LineNo: 1, Old: "kafka", New: "rabbit"},
+        {Path: changedPath, LineNo: 1, Old: "kafka", New: "rabbit"},
+    }
+    applied, err := Apply(changes)
+    if err == nil {
+        t.Errorf("got no error for %v", editedPath)
+    }
+    if !reflect.DeepEqual(applied, changes[1:]) {
+        t.Errorf("got %+v applied, want %+v", applied, changes[1:])
+    }
+    if got := readFile(t, changedPath); got != "rabbit\n" {
+        t.Errorf("got %q, want %q", got, "rabbit\n")
+    }
+}
+
+func TestWriteFileAtomicallyKeepsMode(t *testing.T) {
+    for _, mode := range []os.FileMode{0600, 0640, 0755} {
+        dir := testfiles.NewDir(t)
+        path := filepath.Join(dir, "script.sh")
+        writeFile(t, path, "echo kafka\n", mode)
+        if err := WriteFileAtomically(path, []byte("echo rabbit\n")); err != nil {
+            t.Fatal(err)
+        }
+        info, err := os.Stat(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if info.Mode().Perm() != mode {
+            t.Errorf("got mode %v, want %v", info.Mode().Perm(), mode)
+        }
+        if got := readFile(t, path); got != "echo rabbit\n" {
+            t.Errorf("got %q, want %q", got, "echo rabbit\n")
+        }
+        //no temp files are left behind
+        if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+            t.Errorf("got %v files in %v, want 1", len(entries), dir)
+        }
+    }
+}
+
+//the file a symlink points to is written, not the symlink
+func TestWriteFileAtomicallyThroughSymlink(t *testing.T) {
+    dir := testfiles.NewDir(t)
+    path := filepath.Join(dir, "notes.md")
+    linkPath := filepath.Join(dir, "link.md")
+    writeFile(t, path, "kafka\n", 0644)
+    if err := os.Symlink(path, linkPath); err != nil {
+        t.Skip(err)
+    }
+    if err := WriteFileAtomically(linkPath, []byte("rabbit\n")); err != nil {
+        t.Fatal(err)
+    }
+    if info, err := os.Lstat(linkPath); err != nil || info.Mode() & os.ModeSymlink == 0 {
+        t.Errorf("%v is no longer a symlink", linkPath)
+    }
+    if got := readFile(t, path); got != "rabbit\n" {
+        t.Errorf("got %q, want %q", got, "rabbit\n")
+    }
+}
+
+func TestUndo(t *testing.T) {
+    dir := testfiles.NewDir(t)
+    original := "kafka\r\nretention\r\nkafka"
+    path := filepath.Join(dir, "notes.md")
+    writeFile(t, path, original, 0644)
+    journal := NewJournal(filepath.Join(dir, "data", JOURNAL_FILE_NAME))
+    applied, err := Apply([]Change{
+        {Path: path, LineNo: 1, Old: "kafka", New: "rabbit"},
+        {Path: path, LineNo: 3, Old: "kafka", New: "rabbit mq"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := journal.Save(applied); err != nil {
+        t.Fatal(err)
+    }
+    reverted, err := journal.Undo()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(reverted, applied) {
+        t.Errorf("got %+v reverted, want %+v", reverted, applied)
+    }
+    if got := readFile(t, path); got != original {
+        t.Errorf("got %q, want the original %q", got, original)
+    }
+    if left, err := journal.Load(); err != nil || len(left) != 0 {
+        t.Errorf("got %+v left in the journal (%v), want none", left, err)
+    }
+    //nothing left to undo
+    if reverted, err := journal.Undo(); err != nil || len(reverted) != 0 {
+        t.Errorf("undoing again reverted %+v (%v), want nothing", reverted, err)
+    }
+}
+
+//changes to files edited since they were written stay in the journal, and
+//the rest are undone
+func TestUndoPartially(t *testing.T) {
+    dir := testfiles.NewDir(t)
+    undonePath := filepath.Join(dir, "undone.md")
+    editedPath := filepath.Join(dir, "edited.md")
+    writeFile(t, undonePath, "kafka\n", 0644)
+    writeFile(t, editedPath, "kafka\n", 0644)
+    journal := NewJournal(filepath.Join(dir, JOURNAL_FILE_NAME))
+    applied, err := Apply([]Change{
+        {Path: undonePath, LineNo: 1, Old: "kafka", New: "rabbit"},
+        {Path: editedPath, LineNo: 1, Old: "kafka", New: "rabbit"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := journal.Save(applied); err != nil {
+        t.Fatal(err)
+    }
+    writeFile(t, editedPath, "rabbit mq\n", 0644)
+    reverted, err := journal.Undo()
+    if err == nil {
+        t.Errorf("got no error for %v", editedPath)
+    }
+    wantReverted := []Change{{Path: undonePath, LineNo: 1, Old: "kafka", New: "rabbit"}}
+    if !reflect.DeepEqual(reverted, wantReverted) {
+        t.Errorf("got %+v reverted, want %+v", reverted, wantReverted)
+    }
+    if got := readFile(t, undonePath); got != "kafka\n" {
+        t.Errorf("got %q in %v, want %q", got, undonePath, "kafka\n")
+    }
+    if got := readFile(t, editedPath); got != "rabbit mq\n" {
+        t.Errorf("got %q in %v, want it left alone", got, editedPath)
+    }
+    wantLeft := []Change{{Path: editedPath, LineNo: 1, Old: "kafka", New: "rabbit"}}
+    if left, err := journal.Load(); err != nil || !reflect.DeepEqual(left, wantLeft) {
+        t.Errorf("got %+v left in the journal (%v), want %+v", left, err, wantLeft)
+    }
+    //once the edit is taken back, the rest can be undone
+    writeFile(t, editedPath, "rabbit\n", 0644)
+    if reverted, err := journal.Undo(); err != nil || !reflect.DeepEqual(reverted, wantLeft) {
+        t.Errorf("undoing again reverted %+v (%v), want %+v", reverted, err, wantLeft)
+    }
+    if got := readFile(t, editedPath); got != "kafka\n" {
+        t.Errorf("got %q in %v, want %q", got, editedPath, "kafka\n")
+    }
+}
@@ -0,0 +1,343 @@
+package search
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "log"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+)
+
+//With Options.SearchArchives, zip and tar archives (compressed or not) are
+//searched member by member instead of as a whole. Members are Files with
+//paths like notes.zip!/2019/kafka.md, and go through the same ignore
+//patterns and shebangs as files on disk. Tar has no index, so the members
+//of a tar archive are all read in one pass through it and kept in memory
+//until the archive is modified, rather than decompressing and reading
+//through the archive up to each member every time one is opened - which
+//would be every search. Archives too big to keep are still read through up
+//to each member.
+
+const ARCHIVE_MEMBER_SEPARATOR = "!/"
+
+//bytes of the members of tar archives kept in memory at most
+const TAR_CACHE_MAX_BYTES = 128 * 1024 * 1024
+
+var errTarTooLarge = errors.New("tar archive too large to keep in memory")
+
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz", ".tar.zst", ".tzst"}
+
+func isArchive(path string) bool {
+    lowerCasePath := strings.ToLower(path)
+    for _, extension := range archiveExtensions {
+        if strings.HasSuffix(lowerCasePath, extension) {
+            return true
+        }
+    }
+    return false
+}
+
+func isZip(path string) bool {
+    return strings.HasSuffix(strings.ToLower(path), ".zip")
+}
+
+//IsArchiveMember returns whether the file is a member of an archive rather
+//than a file on disk
+func (file File) IsArchiveMember() bool {
+    return file.MemberName != ""
+}
+
+//archiveMember is what's known about a member of an archive without
+//reading it
+type archiveMember struct {
+    name string
+    modTime time.Time
+    size int64
+}
+
+//getArchiveMembers returns the regular files in the archive at path
+func getArchiveMembers(path string) ([]archiveMember, error) {
+    var members []archiveMember
+    if isZip(path) {
+        zipReader, err := zip.OpenReader(path)
+        if err != nil {
+            return nil, err
+        }
+        defer zipReader.Close()
+        for _, zipFile := range zipReader.File {
+            if zipFile.Mode().IsRegular() {
+                members = append(members, archiveMember{name: zipFile.Name, modTime: zipFile.Modified, size: int64(zipFile.UncompressedSize64)})
+            }
+        }
+        return members, nil
+    }
+    contents, err := tarCache.get(path)
+    if err == nil {
+        return contents.members, nil
+    } else if err != errTarTooLarge {
+        return nil, err
+    }
+    err = eachTarMember(path, func(header *tar.Header, r io.Reader) bool {
+        members = append(members, archiveMember{name: header.Name, modTime: header.ModTime, size: header.Size})
+        return true
+    })
+    return members, err
+}
+
+//tarContents is all of the members of a tar archive, read in one pass
+type tarContents struct {
+    //of the archive when it was read
+    modTime time.Time
+    size int64
+    members []archiveMember
+    //by name, the first member of a name if there are several
+    contentOfMember map[string][]byte
+    numberOfBytes int64
+}
+
+//tarArchiveCache keeps the contents of the tar archives read last, up to
+//maxBytes of members
+type tarArchiveCache struct {
+    mutex sync.Mutex
+    contentsOfPath map[string]*tarContents
+    //least recently used first
+    paths []string
+    numberOfBytes int64
+    maxBytes int64
+}
+
+var tarCache = newTarArchiveCache(TAR_CACHE_MAX_BYTES)
+
+func newTarArchiveCache(maxBytes int64) *tarArchiveCache {
+    cache := &tarArchiveCache{}
+    cache.contentsOfPath = make(map[string]*tarContents)
+    cache.maxBytes = maxBytes
+    return cache
+}
+
+//get returns the contents of the tar archive at path, reading it if it
+//isn't kept or was modified since it was read. It returns errTarTooLarge
+//for archives whose members don't fit in the cache.
+func (cache *tarArchiveCache) get(path string) (*tarContents, error) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, err
+    }
+    cache.mutex.Lock()
+    contents, ok := cache.contentsOfPath[path]
+    if ok && contents.modTime.Equal(info.ModTime()) && contents.size == info.Size() {
+        cache.use(path)
+        cache.mutex.Unlock()
+        return contents, nil
+    }
+    cache.mutex.Unlock()
+    contents, err = readTar(path, cache.maxBytes)
+    if err != nil {
+        return nil, err
+    }
+    contents.modTime = info.ModTime()
+    contents.size = info.Size()
+    cache.mutex.Lock()
+    defer cache.mutex.Unlock()
+    cache.remove(path)
+    cache.contentsOfPath[path] = contents
+    cache.paths = append(cache.paths, path)
+    cache.numberOfBytes += contents.numberOfBytes
+    for cache.numberOfBytes > cache.maxBytes {
+        cache.remove(cache.paths[0])
+    }
+    return contents, nil
+}
+
+//use moves path to the end of paths, as the most recently used
+func (cache *tarArchiveCache) use(path string) {
+    for i := range cache.paths {
+        if cache.paths[i] == path {
+            cache.paths = append(append(cache.paths[:i], cache.paths[i+1:]...), path)
+            return
+        }
+    }
+}
+
+func (cache *tarArchiveCache) remove(path string) {
+    contents, ok := cache.contentsOfPath[path]
+    if !ok {
+        return
+    }
+    cache.numberOfBytes -= contents.numberOfBytes
+    delete(cache.contentsOfPath, path)
+    for i := range cache.paths {
+        if cache.paths[i] == path {
+            cache.paths = append(cache.paths[:i], cache.paths[i+1:]...)
+            break
+        }
+    }
+}
+
+//readTar reads all of the regular files in the tar archive at path,
+//giving up with errTarTooLarge once they come to more than maxBytes
+func readTar(path string, maxBytes int64) (*tarContents, error) {
+    contents := &tarContents{contentOfMember: make(map[string][]byte)}
+    var readErr error
+    err := eachTarMember(path, func(header *tar.Header, r io.Reader) bool {
+        if contents.numberOfBytes + header.Size > maxBytes {
+            readErr = errTarTooLarge
+            return false
+        }
+        content, err := ioutil.ReadAll(r)
+        if err != nil {
+            readErr = fmt.Errorf("could not read %v of %v: %v", header.Name, path, err)
+            return false
+        }
+        contents.members = append(contents.members, archiveMember{name: header.Name, modTime: header.ModTime, size: header.Size})
+        if _, ok := contents.contentOfMember[header.Name]; !ok {
+            contents.contentOfMember[header.Name] = content
+        }
+        contents.numberOfBytes += int64(len(content))
+        return true
+    })
+    if err != nil {
+        return nil, err
+    }
+    if readErr != nil {
+        return nil, readErr
+    }
+    log.Printf("Read the %v members of %v.", len(contents.members), path)
+    return contents, nil
+}
+
+//eachTarMember calls f with each regular file in the tar archive at path
+//until f returns false
+func eachTarMember(path string, f func(header *tar.Header, r io.Reader) bool) error {
+    osFile, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    decompressed, err := decompress(osFile)
+    if err != nil {
+        return err
+    }
+    defer decompressed.Close()
+    tarReader := tar.NewReader(decompressed)
+    for {
+        header, err := tarReader.Next()
+        if err == io.EOF {
+            return nil
+        } else if err != nil {
+            return err
+        }
+        if header.Typeflag == tar.TypeReg && !f(header, tarReader) {
+            return nil
+        }
+    }
+}
+
+//openArchiveMember opens the member named name of the archive at path
+func openArchiveMember(path string, name string) (io.ReadCloser, error) {
+    if isZip(path) {
+        zipReader, err := zip.OpenReader(path)
+        if err != nil {
+            return nil, err
+        }
+        for _, zipFile := range zipReader.File {
+            if zipFile.Name == name {
+                member, err := zipFile.Open()
+                if err != nil {
+                    zipReader.Close()
+                    return nil, err
+                }
+                return &readCloser{member, []func() error{member.Close, zipReader.Close}}, nil
+            }
+        }
+        zipReader.Close()
+        return nil, fmt.Errorf("%v has no member %v", path, name)
+    }
+    contents, err := tarCache.get(path)
+    if err == nil {
+        content, ok := contents.contentOfMember[name]
+        if !ok {
+            return nil, fmt.Errorf("%v has no member %v", path, name)
+        }
+        return ioutil.NopCloser(bytes.NewReader(content)), nil
+    } else if err != errTarTooLarge {
+        return nil, err
+    }
+    //the member is read into memory, since the archive has to be closed
+    //after reading through it
+    var content []byte
+    found := false
+    err = eachTarMember(path, func(header *tar.Header, r io.Reader) bool {
+        if header.Name != name {
+            return true
+        }
+        var readErr error
+        content, readErr = ioutil.ReadAll(r)
+        if readErr != nil {
+            log.Printf("Could not read %v of %v: %v", name, path, readErr)
+        }
+        found = true
+        return false
+    })
+    if err != nil {
+        return nil, err
+    }
+    if !found {
+        return nil, fmt.Errorf("%v has no member %v", path, name)
+    }
+    return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+//isMemberIgnored returns whether the member named name is ignored by any
+//of patternsToIgnore, which are matched against the name of each
+//directory the member is in and its own name, like they are against the
+//files and directories that are walked
+func isMemberIgnored(name string, patternsToIgnore []string) bool {
+    for _, component := range strings.Split(strings.Trim(name, "/"), "/") {
+        for _, patternToIgnore := range patternsToIgnore {
+            if isMatched, _ := filepath.Match(patternToIgnore, component); isMatched {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+//discoverInArchive sends each member of the archive file that isn't
+//ignored and has one of options.FileShebangs
+func discoverInArchive(file File, options Options, send func(File) error) error {
+    members, err := getArchiveMembers(file.Path)
+    if err != nil {
+        log.Printf("Could not read archive %v: %v", file.Path, err)
+        return nil
+    }
+    for _, member := range members {
+        if isMemberIgnored(member.name, options.PatternsToIgnore) {
+            continue
+        }
+        memberFile := File{
+            //tar members are often named ./path
+            Path: file.Path + ARCHIVE_MEMBER_SEPARATOR + strings.TrimPrefix(path.Clean("/" + member.name), "/"),
+            Root: file.Root,
+            ModTime: member.modTime,
+            Size: member.size,
+            ArchivePath: file.Path,
+            MemberName: member.name,
+        }
+        if !memberFile.hasShebang(options.FileShebangs) {
+            continue
+        }
+        if err := send(memberFile); err != nil {
+            return err
+        }
+    }
+    return nil
+}
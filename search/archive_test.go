@@ -0,0 +1,170 @@
+package search
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "testing"
+    "time"
+
+    "debounce_grep/internal/testfiles"
+)
+
+//writeTarGz writes a gzipped tar archive of members (name to content) to
+//path, with members in order of names
+func writeTarGz(t *testing.T, path string, names []string, members map[string]string) {
+    var buffer bytes.Buffer
+    gzipWriter := gzip.NewWriter(&buffer)
+    tarWriter := tar.NewWriter(gzipWriter)
+    for _, name := range names {
+        content := members[name]
+        header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+        if err := tarWriter.WriteHeader(header); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := tarWriter.Write([]byte(content)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := tarWriter.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if err := gzipWriter.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func readMember(t *testing.T, path string, name string) string {
+    r, err := openArchiveMember(path, name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer r.Close()
+    content, err := ioutil.ReadAll(r)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(content)
+}
+
+func TestSearchTarMembers(t *testing.T) {
+    dir := testfiles.WriteFiles(t, nil)
+    path := filepath.Join(dir, "notes.tar.gz")
+    names := []string{"./kafka.md", "rabbit.md", "2019/kafka.md"}
+    writeTarGz(t, path, names, map[string]string{
+        "./kafka.md": "*study\nkafka retention\n",
+        "rabbit.md": "*study\nrabbit\n",
+        "2019/kafka.md": "*study\nold kafka notes\n",
+    })
+    files := discoverAll(Options{DirsToSearch: []string{dir}, FileShebangs: []string{"*study"}, SearchArchives: true})
+    wantPaths := []string{"notes.tar.gz!/2019/kafka.md", "notes.tar.gz!/kafka.md", "notes.tar.gz!/rabbit.md"}
+    if got := getRelativePaths(files); !reflect.DeepEqual(got, wantPaths) {
+        t.Fatalf("got %q, want %q", got, wantPaths)
+    }
+    query, err := ParseQuery("kafka", FILE_SCOPE)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var got []string
+    for result := range Search(context.Background(), files, query) {
+        for _, line := range result.LinesWithMatches {
+            got = append(got, fmt.Sprintf("%v:%v", result.File.RelativePath(), line.LineNo))
+        }
+    }
+    sort.Strings(got)
+    want := []string{"notes.tar.gz!/2019/kafka.md:2", "notes.tar.gz!/kafka.md:2"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("got %q, want %q", got, want)
+    }
+}
+
+func TestTarArchiveCache(t *testing.T) {
+    path := filepath.Join(testfiles.WriteFiles(t, nil), "notes.tar.gz")
+    names := []string{"a.md", "b.md"}
+    writeTarGz(t, path, names, map[string]string{"a.md": "kafka\n", "b.md": "rabbit\n"})
+    cache := newTarArchiveCache(1024)
+    contents, err := cache.get(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := string(contents.contentOfMember["b.md"]); got != "rabbit\n" {
+        t.Errorf("got %q, want %q", got, "rabbit\n")
+    }
+    //read once until it's modified
+    if cached, err := cache.get(path); err != nil || cached != contents {
+        t.Errorf("the archive was read again (%v)", err)
+    }
+    writeTarGz(t, path, names, map[string]string{"a.md": "kafka\n", "b.md": "rabbit mq\n"})
+    modTime := time.Now().Add(time.Second)
+    os.Chtimes(path, modTime, modTime)
+    contents, err = cache.get(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := string(contents.contentOfMember["b.md"]); got != "rabbit mq\n" {
+        t.Errorf("got %q after the archive was modified, want %q", got, "rabbit mq\n")
+    }
+    if cache.numberOfBytes != int64(len("kafka\nrabbit mq\n")) {
+        t.Errorf("got %v bytes kept, want %v", cache.numberOfBytes, len("kafka\nrabbit mq\n"))
+    }
+    //least recently used archives are dropped to make room
+    otherPath := filepath.Join(filepath.Dir(path), "other.tar.gz")
+    writeTarGz(t, otherPath, []string{"c.md"}, map[string]string{"c.md": string(make([]byte, 1010))})
+    if _, err := cache.get(otherPath); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := cache.contentsOfPath[path]; ok || len(cache.paths) != 1 {
+        t.Errorf("got %q kept, want only %v", cache.paths, otherPath)
+    }
+}
+
+//members of archives are modified when their archive is
+func TestArchiveMemberIsModifiedSince(t *testing.T) {
+    dir := testfiles.WriteFiles(t, nil)
+    path := filepath.Join(dir, "notes.tar.gz")
+    writeTarGz(t, path, []string{"a.md"}, map[string]string{"a.md": "kafka\n"})
+    files := discoverAll(Options{DirsToSearch: []string{dir}, SearchArchives: true})
+    if len(files) != 1 || !files[0].IsArchiveMember() {
+        t.Fatalf("got %+v, want a.md in %v", files, path)
+    }
+    searchedAt := time.Now().Add(time.Hour)
+    if files[0].IsModifiedSince(searchedAt) {
+        t.Errorf("got %v modified before its archive was", files[0].RelativePath())
+    }
+    modTime := searchedAt.Add(2 * time.Second)
+    os.Chtimes(path, modTime, modTime)
+    if !files[0].IsModifiedSince(searchedAt) {
+        t.Errorf("got %v not modified after its archive was", files[0].RelativePath())
+    }
+}
+
+//members of archives too big to keep are read through up to them
+func TestOpenMemberOfLargeTar(t *testing.T) {
+    path := filepath.Join(testfiles.WriteFiles(t, nil), "notes.tar.gz")
+    writeTarGz(t, path, []string{"a.md", "b.md"}, map[string]string{"a.md": "kafka\n", "b.md": "rabbit\n"})
+    keptCache := tarCache
+    tarCache = newTarArchiveCache(8)
+    defer func() {
+        tarCache = keptCache
+    }()
+    if _, err := tarCache.get(path); err != errTarTooLarge {
+        t.Errorf("got %v, want %v", err, errTarTooLarge)
+    }
+    if got := readMember(t, path, "b.md"); got != "rabbit\n" {
+        t.Errorf("got %q, want %q", got, "rabbit\n")
+    }
+    members, err := getArchiveMembers(path)
+    if err != nil || len(members) != 2 {
+        t.Errorf("got members %+v (%v), want a.md and b.md", members, err)
+    }
+}
@@ -0,0 +1,175 @@
+package search
+
+import (
+    "bufio"
+    "bytes"
+    "compress/bzip2"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "log"
+    "os"
+    "os/exec"
+)
+
+//Compressed files are searched decompressed. What a file is compressed
+//with is told from the magic bytes it starts with rather than from its
+//extension, gzip and bzip2 being decompressed in process and xz and zstd
+//with the xz and zstd commands, which have to be installed for those files
+//to be searched. Files that start like compressed ones but can't be
+//decompressed (like a text file starting with BZh9) are searched as they
+//are.
+
+type compression struct {
+    name string
+    magic []byte
+    //checks the bytes after the magic too, if set
+    isStart func(start []byte) bool
+    //command that decompresses stdin to stdout, nil if it's done in process
+    command []string
+}
+
+var compressions = []compression{
+    {name: "gzip", magic: []byte{0x1f, 0x8b}},
+    //followed by the block size, 1 to 9 hundred KB
+    {name: "bzip2", magic: []byte("BZh"), isStart: func(start []byte) bool {
+        return len(start) > 3 && '1' <= start[3] && start[3] <= '9'
+    }},
+    {name: "xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, command: []string{"xz", "-dc"}},
+    {name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, command: []string{"zstd", "-dc"}},
+}
+
+//longest magic of the compressions
+const MAX_MAGIC_LENGTH = 6
+
+//getCompression returns the compression start (the first bytes of a
+//stream) says the stream is compressed with, nil if it isn't compressed
+func getCompression(start []byte) *compression {
+    for i := range compressions {
+        compression := &compressions[i]
+        if bytes.HasPrefix(start, compression.magic) && (compression.isStart == nil || compression.isStart(start)) {
+            return compression
+        }
+    }
+    return nil
+}
+
+//readCloser closes all of closers when it's closed, the first error being
+//returned
+type readCloser struct {
+    io.Reader
+    closers []func() error
+}
+
+func (r *readCloser) Close() error {
+    var firstErr error
+    for _, close := range r.closers {
+        if err := close(); err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    return firstErr
+}
+
+//returned by decompress() for streams that start like compressed ones but
+//aren't
+var errNotDecompressible = errors.New("could not be decompressed")
+
+//openDecompressed opens the stream named name with open and returns it
+//decompressed if it's compressed, as it is otherwise - or if it can't be
+//decompressed, in which case it's opened again
+func openDecompressed(name string, open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+    r, err := open()
+    if err != nil {
+        return nil, err
+    }
+    decompressed, err := decompress(r)
+    if err == nil {
+        //streams that can't be decompressed fail on the first read
+        buffered := bufio.NewReader(decompressed)
+        if _, err = buffered.Peek(1); err == nil || err == io.EOF {
+            return &readCloser{buffered, []func() error{decompressed.Close}}, nil
+        }
+        decompressed.Close()
+    } else if err != errNotDecompressible {
+        return nil, err
+    }
+    log.Printf("Reading %v as it is since it couldn't be decompressed: %v", name, err)
+    return open()
+}
+
+//decompress returns r decompressed if it's compressed, r as it is
+//otherwise. Closing what's returned closes r.
+func decompress(r io.ReadCloser) (io.ReadCloser, error) {
+    buffered := bufio.NewReader(r)
+    //a stream shorter than the magic just isn't compressed
+    start, _ := buffered.Peek(MAX_MAGIC_LENGTH)
+    compression := getCompression(start)
+    if compression == nil {
+        return &readCloser{buffered, []func() error{r.Close}}, nil
+    }
+    switch compression.name {
+        case "gzip":
+            gzipReader, err := gzip.NewReader(buffered)
+            if err != nil {
+                r.Close()
+                log.Printf("Could not decompress gzip: %v", err)
+                return nil, errNotDecompressible
+            }
+            //files of several gzip streams (like from cat a.gz b.gz) are
+            //read through as one
+            return &readCloser{gzipReader, []func() error{gzipReader.Close, r.Close}}, nil
+        case "bzip2":
+            return &readCloser{bzip2.NewReader(buffered), []func() error{r.Close}}, nil
+    }
+    command := exec.Command(compression.command[0], compression.command[1:]...)
+    command.Stdin = buffered
+    stdout, err := command.StdoutPipe()
+    if err != nil {
+        r.Close()
+        return nil, err
+    }
+    if err := command.Start(); err != nil {
+        r.Close()
+        return nil, fmt.Errorf("could not decompress %v: %v", compression.name, err)
+    }
+    waitForCommand := func() error {
+        //killed in case it's closed before all of it was read
+        command.Process.Kill()
+        command.Wait()
+        return nil
+    }
+    return &readCloser{stdout, []func() error{waitForCommand, r.Close}}, nil
+}
+
+//IsCompressed returns whether the file is compressed, so that it's
+//searched decompressed but can't be written to like a text file. Files
+//that only start like compressed ones are searched as they are, and so
+//aren't taken to be compressed.
+func (file File) IsCompressed() bool {
+    if file.IsArchiveMember() || file.IsVirtual() {
+        return false
+    }
+    osFile, err := os.Open(file.Path)
+    if err != nil {
+        return false
+    }
+    defer osFile.Close()
+    start := make([]byte, MAX_MAGIC_LENGTH)
+    n, _ := io.ReadFull(osFile, start)
+    if getCompression(start[:n]) == nil {
+        return false
+    }
+    if _, err := osFile.Seek(0, io.SeekStart); err != nil {
+        return true
+    }
+    decompressed, err := decompress(ioutil.NopCloser(osFile))
+    if err != nil {
+        return err != errNotDecompressible
+    }
+    defer decompressed.Close()
+    _, err = bufio.NewReader(decompressed).Peek(1)
+    return err == nil || err == io.EOF
+}
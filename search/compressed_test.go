@@ -0,0 +1,68 @@
+package search
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/hex"
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+
+    "debounce_grep/internal/testfiles"
+)
+
+func gzipString(t *testing.T, s string) string {
+    var buffer bytes.Buffer
+    gzipWriter := gzip.NewWriter(&buffer)
+    gzipWriter.Write([]byte(s))
+    if err := gzipWriter.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return buffer.String()
+}
+
+func TestOpenCompressed(t *testing.T) {
+    //there's no bzip2 writer in the standard library
+    bzip2Content, err := hex.DecodeString("425a683931415926535935116642000004d1800010400023299400200022000f508069a68c8c4087db381cf177245385090351166420")
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name string
+        content string
+        want string
+        wantCompressed bool
+    }{
+        {"plain", "kafka retention\n", "kafka retention\n", false},
+        {"gzip", gzipString(t, "kafka retention\n"), "kafka retention\n", true},
+        {"bzip2", string(bzip2Content), "kafka retention\n", true},
+        {"starts with BZh", "BZh is how bzip2 files start\n", "BZh is how bzip2 files start\n", false},
+        {"starts with BZh and a block size", "BZh9 isn't bzip2\n", "BZh9 isn't bzip2\n", false},
+        {"starts with the gzip magic", "\x1f\x8b isn't gzip\n", "\x1f\x8b isn't gzip\n", false},
+        {"empty", "", "", false},
+    }
+    dir := testfiles.WriteFiles(t, nil)
+    for _, test := range tests {
+        path := filepath.Join(dir, "notes")
+        if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+            t.Fatal(err)
+        }
+        file := File{Path: path}
+        if got := file.IsCompressed(); got != test.wantCompressed {
+            t.Errorf("%v: got compressed %v, want %v", test.name, got, test.wantCompressed)
+        }
+        r, err := file.Open()
+        if err != nil {
+            t.Errorf("%v: %v", test.name, err)
+            continue
+        }
+        content, err := ioutil.ReadAll(r)
+        r.Close()
+        if err != nil {
+            t.Errorf("%v: %v", test.name, err)
+        }
+        if string(content) != test.want {
+            t.Errorf("%v: got %q, want %q", test.name, content, test.want)
+        }
+    }
+}
@@ -0,0 +1,72 @@
+package search_test
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "path/filepath"
+
+    "debounce_grep/search"
+)
+
+//writeNotes writes a few notes to a new temp dir, which the caller removes
+func writeNotes() string {
+    dir, err := ioutil.TempDir("", "notes")
+    if err != nil {
+        log.Fatal(err)
+    }
+    notes := map[string]string{
+        "kafka.md": "*study\n# kafka\nlog retention is 7 days\n",
+        "draft.md": "*study\nkafka retention, draft\n",
+        "groceries.md": "kafka retention isn't on the list\n",
+        ".git/HEAD": "*study\n",
+    }
+    for path, content := range notes {
+        fullPath := filepath.Join(dir, path)
+        os.MkdirAll(filepath.Dir(fullPath), 0755)
+        if err := ioutil.WriteFile(fullPath, []byte(content), 0644); err != nil {
+            log.Fatal(err)
+        }
+    }
+    return dir
+}
+
+func ExampleDiscover() {
+    dir := writeNotes()
+    defer os.RemoveAll(dir)
+    options := search.Options{
+        DirsToSearch: []string{dir},
+        FileShebangs: []string{"*study"},
+        PatternsToIgnore: []string{".git"},
+    }
+    for file := range search.Discover(context.Background(), options) {
+        fmt.Println(file.RelativePath())
+    }
+    // Output:
+    // draft.md
+    // kafka.md
+}
+
+func ExampleSearch() {
+    dir := writeNotes()
+    defer os.RemoveAll(dir)
+    ctx := context.Background()
+    var files []search.File
+    for file := range search.Discover(ctx, search.Options{DirsToSearch: []string{dir}, FileShebangs: []string{"*study"}}) {
+        files = append(files, file)
+    }
+    query, err := search.ParseQuery("kafka retention -draft", search.FILE_SCOPE)
+    if err != nil {
+        log.Fatal(err)
+    }
+    for result := range search.Search(ctx, files, query) {
+        for _, line := range result.LinesWithMatches {
+            fmt.Printf("%v:%v: %v\n", result.File.RelativePath(), line.LineNo, line.Text)
+        }
+    }
+    // Output:
+    // kafka.md:2: # kafka
+    // kafka.md:3: log retention is 7 days
+}
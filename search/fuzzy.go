@@ -0,0 +1,186 @@
+package search
+
+import (
+    "unicode"
+)
+
+//Fuzzy matching is done the way fzf does it: a term matches a line if its
+//characters appear in the line in order, and the match is scored with
+//bonuses for characters at the start of words and for runs of consecutive
+//characters and penalties for the gaps in between. The match found is the
+//shortest one starting from the first occurrence of the term's first
+//character, which isn't always the best scoring one but is cheap to find.
+//Matching ignores case unless the term has an upper case character in it.
+
+const (
+    SCORE_MATCH = 16
+    SCORE_GAP_START = -3
+    SCORE_GAP_EXTENSION = -1
+    //character after a space, punctuation, etc.
+    BONUS_BOUNDARY = SCORE_MATCH / 2
+    //space, punctuation, etc. itself
+    BONUS_NON_WORD = SCORE_MATCH / 2
+    //upper case character after a lower case one or a digit after a letter
+    BONUS_CAMEL_123 = BONUS_BOUNDARY - 1
+    //least bonus a character consecutive to the one before it gets
+    BONUS_CONSECUTIVE = -(SCORE_GAP_START + SCORE_GAP_EXTENSION)
+    //bonus for the first character of a term is counted this many times
+    BONUS_FIRST_CHAR_MULTIPLIER = 2
+)
+
+type charClass int
+
+const (
+    CHAR_NON_WORD charClass = iota
+    CHAR_LOWER
+    CHAR_UPPER
+    CHAR_LETTER
+    CHAR_NUMBER
+)
+
+func getCharClass(char rune) charClass {
+    switch {
+        case unicode.IsLower(char):
+            return CHAR_LOWER
+        case unicode.IsUpper(char):
+            return CHAR_UPPER
+        case unicode.IsLetter(char):
+            return CHAR_LETTER
+        case unicode.IsNumber(char):
+            return CHAR_NUMBER
+    }
+    return CHAR_NON_WORD
+}
+
+func getBonus(previousClass charClass, class charClass) int {
+    if previousClass == CHAR_NON_WORD && class != CHAR_NON_WORD {
+        return BONUS_BOUNDARY
+    } else if previousClass == CHAR_LOWER && class == CHAR_UPPER || previousClass != CHAR_NUMBER && class == CHAR_NUMBER {
+        return BONUS_CAMEL_123
+    } else if class == CHAR_NON_WORD {
+        return BONUS_NON_WORD
+    }
+    return 0
+}
+
+func hasUpperCase(term string) bool {
+    for _, char := range term {
+        if unicode.IsUpper(char) {
+            return true
+        }
+    }
+    return false
+}
+
+//fuzzyMatch returns the start and end byte offsets of each character of
+//term matched in line and the score of the match, ok being false if the
+//characters of term don't all appear in line in order
+func fuzzyMatch(line string, term string) (matchIndeces [][]int, score int, ok bool) {
+    text := []rune(line)
+    pattern := []rune(term)
+    if len(pattern) == 0 {
+        return nil, 0, false
+    }
+    isCaseSensitive := hasUpperCase(term)
+    charsAreEqual := func(textChar rune, patternChar rune) bool {
+        if isCaseSensitive {
+            return textChar == patternChar
+        }
+        return unicode.ToLower(textChar) == unicode.ToLower(patternChar)
+    }
+
+    //1) go forward to find where the first occurrence of the whole term ends
+    patternIndex := 0
+    start, end := -1, -1
+    for i, char := range text {
+        if charsAreEqual(char, pattern[patternIndex]) {
+            if start == -1 {
+                start = i
+            }
+            patternIndex ++
+            if patternIndex == len(pattern) {
+                end = i + 1
+                break
+            }
+        }
+    }
+    if end == -1 {
+        return nil, 0, false
+    }
+    //2) go backward from there to find the latest start of that occurrence
+    patternIndex = len(pattern) - 1
+    for i := end - 1; i >= start; i-- {
+        if charsAreEqual(text[i], pattern[patternIndex]) {
+            patternIndex --
+            if patternIndex < 0 {
+                start = i
+                break
+            }
+        }
+    }
+
+    //3) score the characters matched going forward through that window
+    positions := make([]int, 0, len(pattern))
+    previousClass := CHAR_NON_WORD
+    if start > 0 {
+        previousClass = getCharClass(text[start-1])
+    }
+    patternIndex = 0
+    isInGap := false
+    numberOfConsecutive := 0
+    firstBonus := 0
+    for i := start; i < end; i++ {
+        class := getCharClass(text[i])
+        if patternIndex < len(pattern) && charsAreEqual(text[i], pattern[patternIndex]) {
+            positions = append(positions, i)
+            score += SCORE_MATCH
+            bonus := getBonus(previousClass, class)
+            if numberOfConsecutive == 0 {
+                firstBonus = bonus
+            } else {
+                //a run of consecutive characters keeps the bonus of the
+                //character it started with
+                if bonus >= BONUS_BOUNDARY && bonus > firstBonus {
+                    firstBonus = bonus
+                }
+                bonus = maxInt(bonus, maxInt(firstBonus, BONUS_CONSECUTIVE))
+            }
+            if patternIndex == 0 {
+                score += bonus * BONUS_FIRST_CHAR_MULTIPLIER
+            } else {
+                score += bonus
+            }
+            isInGap = false
+            numberOfConsecutive ++
+            patternIndex ++
+        } else {
+            if isInGap {
+                score += SCORE_GAP_EXTENSION
+            } else {
+                score += SCORE_GAP_START
+            }
+            isInGap = true
+            numberOfConsecutive = 0
+            firstBonus = 0
+        }
+        previousClass = class
+    }
+
+    //positions are of runes, convert them to byte offsets in line
+    byteOffsets := make([]int, 0, len(text) + 1)
+    for byteOffset := range line {
+        byteOffsets = append(byteOffsets, byteOffset)
+    }
+    byteOffsets = append(byteOffsets, len(line))
+    for _, position := range positions {
+        matchIndeces = append(matchIndeces, []int{byteOffsets[position], byteOffsets[position+1]})
+    }
+    return matchIndeces, score, true
+}
+
+func maxInt(a int, b int) int {
+    if a > b {
+        return a
+    }
+    return b
+}
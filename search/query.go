@@ -0,0 +1,339 @@
+package search
+
+import (
+    "errors"
+    "sort"
+    "strings"
+)
+
+//Queries are made up of terms separated by spaces, all of which have to
+//match (AND). Terms joined by | are alternatives of which only one has to
+//match (OR), terms starting with - must not match (NOT) and text in double
+//quotes is matched as a single term, spaces and all:
+//
+//    kafka retention|compaction -draft "consumer group"
+//
+//With FILE_SCOPE each term can match on a different line of a file, with
+//LINE_SCOPE every term has to be satisfied by the same line.
+//
+//If Fuzzy is set, terms that aren't quoted or negated are matched fuzzily
+//(see fuzzyMatch()) instead of as substrings, and lines are scored by how
+//well they match.
+//
+//Target is what of a file is matched against the query: its contents, its
+//path relative to the directory it was found in, or both. A path has to
+//match the whole query on its own, like a line does with LINE_SCOPE.
+
+type Scope string
+
+type Target string
+
+const (
+    FILE_SCOPE Scope = "file"
+    LINE_SCOPE Scope = "line"
+    OR_OPERATOR = "|"
+    NOT_OPERATOR = "-"
+    QUOTE = "\""
+    CONTENT_TARGET Target = "content"
+    PATH_TARGET Target = "path"
+    BOTH_TARGETS Target = "both"
+)
+
+type Query struct {
+    Text string
+    Scope Scope
+    Fuzzy bool
+    //CONTENT_TARGET if empty
+    Target Target
+    //each group is satisfied if any of its terms match, and every
+    //group has to be satisfied
+    groups [][]queryTerm
+    //none of these can match
+    negatedTerms []string
+}
+
+//ParseQuery parses text into a Query matched against the contents of
+//files. It's lenient with queries that are
+//still being typed - a trailing | or an unclosed quote is fine - but a query
+//has to have at least one term that isn't negated.
+func ParseQuery(text string, scope Scope) (*Query, error) {
+    query := &Query{Text: text, Scope: scope, Target: CONTENT_TARGET}
+    joinWithPreviousGroup := false
+    for _, token := range tokenizeQuery(text) {
+        if token.isOrOperator {
+            joinWithPreviousGroup = len(query.groups) > 0
+            continue
+        }
+        if token.isNegated {
+            if joinWithPreviousGroup {
+                return nil, errors.New("negated terms can't be alternatives joined with |")
+            }
+            query.negatedTerms = append(query.negatedTerms, token.term.text)
+            continue
+        }
+        if joinWithPreviousGroup {
+            lastGroupIndex := len(query.groups) - 1
+            query.groups[lastGroupIndex] = append(query.groups[lastGroupIndex], token.term)
+        } else {
+            query.groups = append(query.groups, []queryTerm{token.term})
+        }
+        joinWithPreviousGroup = false
+    }
+    if len(query.groups) == 0 {
+        return nil, errors.New("query needs at least one term that isn't negated")
+    }
+    return query, nil
+}
+
+type queryTerm struct {
+    text string
+    //quoted terms are always matched exactly
+    isPhrase bool
+}
+
+type queryToken struct {
+    term queryTerm
+    isNegated bool
+    isOrOperator bool
+}
+
+func tokenizeQuery(text string) []queryToken {
+    var tokens []queryToken
+    for i := 0; i < len(text); {
+        char := text[i:i+1]
+        if char == " " {
+            i ++
+            continue
+        }
+        if char == OR_OPERATOR {
+            tokens = append(tokens, queryToken{isOrOperator: true})
+            i ++
+            continue
+        }
+        token := queryToken{}
+        //a lone - is just a term
+        if char == NOT_OPERATOR && i+1 < len(text) && text[i+1:i+2] != " " && text[i+1:i+2] != OR_OPERATOR {
+            token.isNegated = true
+            i ++
+        }
+        if text[i:i+1] == QUOTE {
+            token.term.isPhrase = true
+            end := strings.Index(text[i+1:], QUOTE)
+            if end == -1 {
+                //unclosed quote, take the rest of the query
+                token.term.text = text[i+1:]
+                i = len(text)
+            } else {
+                token.term.text = text[i+1:i+1+end]
+                i += end + 2
+            }
+        } else {
+            end := strings.IndexAny(text[i:], " " + OR_OPERATOR)
+            if end == -1 {
+                end = len(text) - i
+            }
+            token.term.text = text[i:i+end]
+            i += end
+        }
+        if len(token.term.text) > 0 {
+            tokens = append(tokens, token)
+        }
+    }
+    return tokens
+}
+
+//PositiveTerms returns the terms of the query that aren't negated
+func (query *Query) PositiveTerms() []string {
+    var terms []string
+    for _, group := range query.groups {
+        for _, term := range group {
+            terms = append(terms, term.text)
+        }
+    }
+    return terms
+}
+
+//Narrows returns whether every file that matches the query also matches
+//previous, as when a term of previous is typed further, so that only the
+//files that matched previous have to be searched for the query. It holds if
+//each group of previous has a group of the query every term of which
+//implies one of the group's terms, and each negated term of previous
+//contains a negated term of the query.
+func (query *Query) Narrows(previous *Query) bool {
+    if query.Scope != previous.Scope || query.Fuzzy != previous.Fuzzy || query.Target != previous.Target {
+        return false
+    }
+    for _, previousGroup := range previous.groups {
+        isImplied := false
+        for _, group := range query.groups {
+            if query.impliesGroup(group, previousGroup) {
+                isImplied = true
+                break
+            }
+        }
+        if !isImplied {
+            return false
+        }
+    }
+    for _, previousTerm := range previous.negatedTerms {
+        isImplied := false
+        for _, term := range query.negatedTerms {
+            if strings.Contains(previousTerm, term) {
+                isImplied = true
+                break
+            }
+        }
+        if !isImplied {
+            return false
+        }
+    }
+    return true
+}
+
+//impliesGroup returns whether a line matching a term of group always
+//matches a term of previousGroup
+func (query *Query) impliesGroup(group []queryTerm, previousGroup []queryTerm) bool {
+    for _, term := range group {
+        isImplied := false
+        for _, previousTerm := range previousGroup {
+            if query.impliesTerm(term, previousTerm) {
+                isImplied = true
+                break
+            }
+        }
+        if !isImplied {
+            return false
+        }
+    }
+    return true
+}
+
+//impliesTerm returns whether a line matching term always matches
+//previousTerm: a line containing term contains what term contains, and has
+//its characters in order for fuzzy matching - but a term matched fuzzily
+//doesn't imply one matched exactly
+func (query *Query) impliesTerm(term queryTerm, previousTerm queryTerm) bool {
+    isFuzzy := query.Fuzzy && !term.isPhrase
+    isPreviousFuzzy := query.Fuzzy && !previousTerm.isPhrase
+    if isFuzzy && !isPreviousFuzzy {
+        return false
+    }
+    return strings.Contains(term.text, previousTerm.text)
+}
+
+//lineMatch is how a single line matched a query
+type lineMatch struct {
+    //merged start and end offsets of occurrences of positive terms
+    matchIndeces [][]int
+    //which of the query's groups have a term in the line
+    satisfiedGroups []bool
+    hasNegatedTerm bool
+    //sum of the best score of each group's terms in fuzzy mode, 0 otherwise
+    score int
+}
+
+func (query *Query) matchLine(line string) lineMatch {
+    match := lineMatch{satisfiedGroups: make([]bool, len(query.groups))}
+    for groupIndex, group := range query.groups {
+        bestScore := 0
+        for _, term := range group {
+            var termIndeces [][]int
+            termScore := 0
+            if query.Fuzzy && !term.isPhrase {
+                termIndeces, termScore, _ = fuzzyMatch(line, term.text)
+            } else {
+                termIndeces = findAllIndeces(line, term.text)
+            }
+            if len(termIndeces) > 0 {
+                if !match.satisfiedGroups[groupIndex] || termScore > bestScore {
+                    bestScore = termScore
+                }
+                match.satisfiedGroups[groupIndex] = true
+                match.matchIndeces = append(match.matchIndeces, termIndeces...)
+            }
+        }
+        match.score += bestScore
+    }
+    for _, term := range query.negatedTerms {
+        if strings.Contains(line, term) {
+            match.hasNegatedTerm = true
+            break
+        }
+    }
+    match.matchIndeces = mergeIndeces(match.matchIndeces)
+    return match
+}
+
+//MatchLine matches a single line of a file against the query, for lines
+//appended to a file that's being followed. ok is false if the line has no
+//matches or has a negated term, or if it doesn't satisfy the whole query on
+//its own when isFileMatched is false (no earlier line of the file having
+//matched) or with LINE_SCOPE.
+func (query *Query) MatchLine(lineNo int, line string, isFileMatched bool) (lineWithMatches LineWithMatches, ok bool) {
+    if !query.matchesContent() {
+        return lineWithMatches, false
+    }
+    match := query.matchLine(line)
+    if match.hasNegatedTerm || len(match.matchIndeces) == 0 {
+        return lineWithMatches, false
+    }
+    if (query.Scope == LINE_SCOPE || !isFileMatched) && !match.satisfiesAllGroups() {
+        return lineWithMatches, false
+    }
+    return LineWithMatches{LineNo: lineNo, MatchIndeces: match.matchIndeces, Text: line, Score: match.score}, true
+}
+
+func (query *Query) matchesContent() bool {
+    return query.Target != PATH_TARGET
+}
+
+func (query *Query) matchesPath() bool {
+    return query.Target == PATH_TARGET || query.Target == BOTH_TARGETS
+}
+
+func (match lineMatch) satisfiesAllGroups() bool {
+    for _, isSatisfied := range match.satisfiedGroups {
+        if !isSatisfied {
+            return false
+        }
+    }
+    return true
+}
+
+//start and end offsets of non-overlapping occurrences of term in line
+func findAllIndeces(line string, term string) [][]int {
+    var indeces [][]int
+    for offset := 0; offset <= len(line) - len(term); {
+        i := strings.Index(line[offset:], term)
+        if i == -1 {
+            break
+        }
+        start := offset + i
+        indeces = append(indeces, []int{start, start + len(term)})
+        offset = start + len(term)
+    }
+    return indeces
+}
+
+//sorts pairs of indeces and merges the ones that overlap, since a line is
+//rendered highlighting one pair after the other
+func mergeIndeces(indeces [][]int) [][]int {
+    if len(indeces) < 2 {
+        return indeces
+    }
+    sort.Slice(indeces, func(i, j int) bool {
+        return indeces[i][0] < indeces[j][0]
+    })
+    merged := [][]int{indeces[0]}
+    for _, pair := range indeces[1:] {
+        last := merged[len(merged)-1]
+        if pair[0] <= last[1] {
+            if pair[1] > last[1] {
+                last[1] = pair[1]
+            }
+            continue
+        }
+        merged = append(merged, pair)
+    }
+    return merged
+}
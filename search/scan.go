@@ -0,0 +1,215 @@
+package search
+
+import (
+    "bytes"
+    "context"
+    "io"
+    "log"
+    "sort"
+)
+
+//Files are searched a chunk of whole lines at a time rather than line by
+//line: each chunk is read into a buffer that's reused for every file of a
+//search, the terms that are matched exactly are looked for across the
+//whole chunk, and only the lines they're found on are cut out of it and
+//matched against the query. Line numbers are counted between those lines,
+//so lines without any term are never turned into strings. Lines longer
+//than the buffer grow it. Fuzzy terms can match any line, so with fuzzy
+//terms every line is matched.
+
+//size of the chunks files are read in
+const SCAN_BUFFER_SIZE = 256 * 1024
+
+//matcher is what's needed to find the lines of chunks that can match a
+//query, worked out once per search
+type matcher struct {
+    query *Query
+    //positive terms matched exactly
+    exactTerms [][]byte
+    negatedTerms [][]byte
+    //whether some positive terms are matched fuzzily, so that any line can
+    //match
+    isEveryLineMatched bool
+    //line starts of the chunk being searched that terms were found on,
+    //reused for each chunk
+    lineStarts []int
+}
+
+func newMatcher(query *Query) *matcher {
+    matcher := &matcher{}
+    matcher.query = query
+    for _, group := range query.groups {
+        for _, term := range group {
+            if query.Fuzzy && !term.isPhrase {
+                matcher.isEveryLineMatched = true
+            } else {
+                matcher.exactTerms = append(matcher.exactTerms, []byte(term.text))
+            }
+        }
+    }
+    for _, term := range query.negatedTerms {
+        matcher.negatedTerms = append(matcher.negatedTerms, []byte(term))
+    }
+    return matcher
+}
+
+//hasNegatedTerm returns whether any line of chunk contains a negated term
+func (matcher *matcher) hasNegatedTerm(chunk []byte) bool {
+    for _, term := range matcher.negatedTerms {
+        for offset := 0; offset < len(chunk); {
+            i := bytes.Index(chunk[offset:], term)
+            if i == -1 {
+                break
+            }
+            hit := offset + i
+            //what's found could take in a line ending
+            line, next := getLine(chunk, bytes.LastIndexByte(chunk[:hit], '\n') + 1)
+            if bytes.Contains(line, term) {
+                return true
+            }
+            offset = next
+        }
+    }
+    return false
+}
+
+//getCandidateLineStarts returns the offsets in chunk of the start of each
+//line a positive term is found on, in order
+func (matcher *matcher) getCandidateLineStarts(chunk []byte) []int {
+    lineStarts := matcher.lineStarts[:0]
+    if matcher.isEveryLineMatched {
+        for start := 0; start < len(chunk); {
+            lineStarts = append(lineStarts, start)
+            end := bytes.IndexByte(chunk[start:], '\n')
+            if end == -1 {
+                break
+            }
+            start += end + 1
+        }
+        matcher.lineStarts = lineStarts
+        return lineStarts
+    }
+    for _, term := range matcher.exactTerms {
+        for offset := 0; offset < len(chunk); {
+            i := bytes.Index(chunk[offset:], term)
+            if i == -1 {
+                break
+            }
+            hit := offset + i
+            lineStarts = append(lineStarts, bytes.LastIndexByte(chunk[:hit], '\n') + 1)
+            //the rest of the line doesn't need to be looked at for this term
+            end := bytes.IndexByte(chunk[hit:], '\n')
+            if end == -1 {
+                break
+            }
+            offset = hit + end + 1
+        }
+    }
+    if len(matcher.exactTerms) > 1 {
+        sort.Ints(lineStarts)
+        lineStarts = removeDuplicateInts(lineStarts)
+    }
+    matcher.lineStarts = lineStarts
+    return lineStarts
+}
+
+//removeDuplicateInts removes repeated ints from sorted ints in place
+func removeDuplicateInts(ints []int) []int {
+    if len(ints) < 2 {
+        return ints
+    }
+    deduplicated := ints[:1]
+    for _, i := range ints[1:] {
+        if i != deduplicated[len(deduplicated)-1] {
+            deduplicated = append(deduplicated, i)
+        }
+    }
+    return deduplicated
+}
+
+//getLine returns the line of chunk starting at start without its line
+//ending, and the offset of the start of the next line
+func getLine(chunk []byte, start int) ([]byte, int) {
+    end := bytes.IndexByte(chunk[start:], '\n')
+    next := len(chunk)
+    if end == -1 {
+        end = len(chunk)
+    } else {
+        end += start
+        next = end + 1
+    }
+    line := chunk[start:end]
+    //like bufio.ScanLines, \r\n line endings are dropped whole
+    if len(line) > 0 && line[len(line)-1] == '\r' {
+        line = line[:len(line)-1]
+    }
+    return line, next
+}
+
+//findHeading returns the number of the first markdown-style heading in
+//chunk, whose first line is firstLineNo, 0 if there isn't one
+func findHeading(chunk []byte, firstLineNo int) int {
+    for start := 0; start < len(chunk); {
+        if chunk[start] == '#' && !bytes.HasPrefix(chunk[start:], []byte("#!")) {
+            return firstLineNo + bytes.Count(chunk[:start], []byte{'\n'})
+        }
+        i := bytes.Index(chunk[start:], []byte("\n#"))
+        if i == -1 {
+            return 0
+        }
+        start += i + 1
+    }
+    return 0
+}
+
+//eachChunk calls f with each chunk of whole lines of the file and the
+//number of its first line, read into *buffer, until f returns false or ctx
+//is done. The last chunk doesn't end with a line break if the file
+//doesn't. It returns the number of lines read.
+func (file File) eachChunk(ctx context.Context, buffer *[]byte, f func(chunk []byte, firstLineNo int) bool) int {
+    r, err := file.Open()
+    if err != nil {
+        log.Printf("Could not open %v: %v", file.Path, err)
+        return 0
+    }
+    defer r.Close()
+    numberOfLines := 0
+    //bytes of a line that didn't fit in the last chunk, at the start of
+    //the buffer
+    n := 0
+    for {
+        if ctx.Err() != nil {
+            return numberOfLines
+        }
+        if n == len(*buffer) {
+            //a line longer than the buffer
+            *buffer = append(*buffer, make([]byte, len(*buffer))...)
+        }
+        chunk := *buffer
+        m, err := io.ReadFull(r, chunk[n:])
+        n += m
+        if err != nil {
+            if err != io.EOF && err != io.ErrUnexpectedEOF {
+                log.Printf("Could not read all of %v: %v", file.Path, err)
+            }
+            if n > 0 {
+                f(chunk[:n], numberOfLines + 1)
+                numberOfLines += bytes.Count(chunk[:n], []byte{'\n'})
+                if chunk[n-1] != '\n' {
+                    numberOfLines ++
+                }
+            }
+            return numberOfLines
+        }
+        end := bytes.LastIndexByte(chunk[n-m:n], '\n')
+        if end == -1 {
+            continue
+        }
+        end += n - m + 1
+        if !f(chunk[:end], numberOfLines + 1) {
+            return numberOfLines
+        }
+        numberOfLines += bytes.Count(chunk[:end], []byte{'\n'})
+        n = copy(chunk, chunk[end:n])
+    }
+}
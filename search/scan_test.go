@@ -0,0 +1,146 @@
+package search
+
+import (
+    "context"
+    "fmt"
+    "reflect"
+    "strings"
+    "testing"
+
+    "debounce_grep/internal/testfiles"
+)
+
+//getLinesWithMatchesByLine is how files were searched before they were
+//searched a chunk at a time, matching every line on its own, kept to check
+//and benchmark getLinesWithMatches() against
+func (file File) getLinesWithMatchesByLine(ctx context.Context, query *Query) ([]LineWithMatches, fileStats) {
+    var linesWithMatches []LineWithMatches
+    var stats fileStats
+    satisfiedGroups := make([]bool, len(query.groups))
+    hasNegatedTerm := false
+    file.eachLine(ctx, func(lineNumber int, line string) bool {
+        stats.numberOfLines = lineNumber
+        if stats.headingLineNo == 0 && strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#!") {
+            stats.headingLineNo = lineNumber
+        }
+        match := query.matchLine(line)
+        if query.Scope == LINE_SCOPE {
+            if match.hasNegatedTerm || !match.satisfiesAllGroups() {
+                return true
+            }
+        } else if match.hasNegatedTerm {
+            hasNegatedTerm = true
+            return false
+        }
+        for groupIndex, isSatisfied := range match.satisfiedGroups {
+            satisfiedGroups[groupIndex] = satisfiedGroups[groupIndex] || isSatisfied
+        }
+        if len(match.matchIndeces) > 0 {
+            linesWithMatches = append(linesWithMatches, LineWithMatches{
+                LineNo: lineNumber,
+                MatchIndeces: match.matchIndeces,
+                Text: line,
+                Score: match.score,
+            })
+        }
+        return true
+    })
+    if query.Scope != LINE_SCOPE {
+        if hasNegatedTerm {
+            return nil, stats
+        }
+        for _, isSatisfied := range satisfiedGroups {
+            if !isSatisfied {
+                return nil, stats
+            }
+        }
+    }
+    return linesWithMatches, stats
+}
+
+//getCorpus returns the files of a corpus of numberOfFiles notes and their
+//size in bytes
+func getCorpus(t testing.TB, numberOfFiles int) ([]File, int64) {
+    dir := testfiles.WriteFiles(t, testfiles.GetCorpus(numberOfFiles))
+    files := discoverAll(Options{DirsToSearch: []string{dir}})
+    var size int64
+    for _, file := range files {
+        size += file.Size
+    }
+    return files, size
+}
+
+var scanTestQueries = []struct {
+    text string
+    scope Scope
+    fuzzy bool
+}{
+    {"kafka", FILE_SCOPE, false},
+    {"kafka retention", FILE_SCOPE, false},
+    {"kafka retention", LINE_SCOPE, false},
+    {"kafka|rabbit offset", FILE_SCOPE, false},
+    {"kafka -draft", FILE_SCOPE, false},
+    {"kafka -draft", LINE_SCOPE, false},
+    {"\"consumer group\" offset", FILE_SCOPE, false},
+    {"nowhere", FILE_SCOPE, false},
+    {"rtntn", FILE_SCOPE, true},
+    {"kfk \"consumer group\"", LINE_SCOPE, true},
+}
+
+func parseScanTestQuery(t testing.TB, text string, scope Scope, fuzzy bool) *Query {
+    query, err := ParseQuery(text, scope)
+    if err != nil {
+        t.Fatal(err)
+    }
+    query.Fuzzy = fuzzy
+    return query
+}
+
+//searching a chunk at a time finds the same lines as matching every line
+func TestGetLinesWithMatches(t *testing.T) {
+    files, _ := getCorpus(t, 100)
+    buffer := make([]byte, SCAN_BUFFER_SIZE)
+    for _, test := range scanTestQueries {
+        query := parseScanTestQuery(t, test.text, test.scope, test.fuzzy)
+        matcher := newMatcher(query)
+        for _, file := range files {
+            lines, stats := file.getLinesWithMatches(context.Background(), matcher, &buffer)
+            wantLines, wantStats := file.getLinesWithMatchesByLine(context.Background(), query)
+            if !reflect.DeepEqual(lines, wantLines) {
+                t.Errorf("%q in %v scope: got %v lines with matches in %v, want %v", test.text, test.scope, len(lines), file.RelativePath(), len(wantLines))
+            }
+            //files ruled out by a negated term aren't read to the end, so
+            //their stats don't matter
+            if wantLines != nil && stats != wantStats {
+                t.Errorf("%q in %v scope: got stats %+v for %v, want %+v", test.text, test.scope, stats, file.RelativePath(), wantStats)
+            }
+        }
+    }
+}
+
+//BenchmarkSearch searches a corpus of notes a chunk at a time and, as a
+//baseline, a line at a time like files were searched before
+func BenchmarkSearch(b *testing.B) {
+    files, size := getCorpus(b, 300)
+    for _, test := range scanTestQueries {
+        query := parseScanTestQuery(b, test.text, test.scope, test.fuzzy)
+        name := fmt.Sprintf("%v/%v/fuzzy=%v", test.text, test.scope, test.fuzzy)
+        b.Run(name + "/chunks", func(b *testing.B) {
+            b.SetBytes(size)
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                for range Search(context.Background(), files, query) {
+                }
+            }
+        })
+        b.Run(name + "/lines", func(b *testing.B) {
+            b.SetBytes(size)
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                for _, file := range files {
+                    file.getLinesWithMatchesByLine(context.Background(), query)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,442 @@
+//Package search is the engine behind debounce_grep: it finds the files to
+//search under a set of directories and searches them for a query, streaming
+//results over channels so that a caller (like the debounce_grep TUI) can
+//render them as they come in and cancel a search that's no longer needed.
+//
+//Finding files with a given shebang in a notes directory and printing the
+//lines that mention a term:
+//
+//    ctx := context.Background()
+//    var files []search.File
+//    for file := range search.Discover(ctx, search.Options{
+//        DirsToSearch: []string{"/home/me/notes"},
+//        FileShebangs: []string{"*study"},
+//        PatternsToIgnore: []string{".git"},
+//    }) {
+//        files = append(files, file)
+//    }
+//    query, err := search.ParseQuery("kafka retention -draft", search.FILE_SCOPE)
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    for result := range search.Search(ctx, files, query) {
+//        for _, line := range result.LinesWithMatches {
+//            fmt.Printf("%v:%v: %v\n", result.File.Path, line.LineNo, line.Text)
+//        }
+//    }
+//
+//Both channels are closed once everything has been sent or ctx is done, so
+//cancelling ctx is enough to stop a search part way through.
+package search
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "io"
+    "io/ioutil"
+    "log"
+    "math"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+    "github.com/mattn/go-zglob"
+)
+
+//Options controls which files Discover() finds
+type Options struct {
+    //directories to walk
+    DirsToSearch []string
+    //lines at least one of which a file needs to contain to be searched,
+    //all files are searched if empty
+    FileShebangs []string
+    //glob patterns of files and directories not to search
+    PatternsToIgnore []string
+    //whether to search the members of zip and tar archives, see archive.go
+    SearchArchives bool
+}
+
+//File is a file that can be searched
+type File struct {
+    Path string
+    //directory the file was found in
+    Root string
+    ModTime time.Time
+    //in bytes
+    Size int64
+    //for members of archives, the archive's path and the member's name in
+    //it - Path being ArchivePath!/MemberName
+    ArchivePath string
+    MemberName string
+    //content of virtual files, nil for files on disk, see virtual.go
+    Buffer *Buffer
+}
+
+//LineWithMatches is a line of a file that contains a term of the query,
+//with the start and end byte offsets of each occurrence of any of the
+//query's positive terms in MatchIndeces
+type LineWithMatches struct {
+    LineNo int
+    MatchIndeces [][]int
+    Text string
+    //how well the line matches a fuzzy query, higher being better, 0 for
+    //queries that aren't fuzzy
+    Score int
+}
+
+//FileResult is a file with at least one line matching the query, or whose
+//path matches it
+type FileResult struct {
+    File File
+    LinesWithMatches []LineWithMatches
+    //start and end offsets in File.Path of matches in the file's path, nil
+    //if the path doesn't match or paths aren't being matched
+    PathMatchIndeces [][]int
+    //best Score of the file's lines and path
+    Score int
+    //total number of matches on all of the file's lines, not counting
+    //matches in its path
+    NumberOfMatches int
+    //how relevant the file is to the query, higher being more relevant,
+    //see getRelevance()
+    Relevance float64
+}
+
+//what's learned about a file while searching it, besides its matches
+type fileStats struct {
+    numberOfLines int
+    //first markdown-style heading, 0 if there isn't one
+    headingLineNo int
+}
+
+//Discover walks options.DirsToSearch and sends each file that isn't ignored
+//and has one of options.FileShebangs, in walk order
+func Discover(ctx context.Context, options Options) <-chan File {
+    ch := make(chan File)
+    go func() {
+        defer close(ch)
+        for _, dirToSearch := range options.DirsToSearch {
+            err := discoverInDir(ctx, dirToSearch, options, ch)
+            if err == context.Canceled || err == context.DeadlineExceeded {
+                return
+            } else if err != nil {
+                log.Printf("Error walking the path %q: %v", dirToSearch, err)
+            }
+        }
+    }()
+    return ch
+}
+
+func discoverInDir(ctx context.Context, dirToSearch string, options Options, ch chan<- File) error {
+    var toIgnore []string
+    return filepath.Walk(dirToSearch, func(path string, info os.FileInfo, e error) error {
+        if e != nil {
+            return e
+        }
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        indexToRemove := -1
+        for toIgnoreIndex, toIgnorePath := range toIgnore {
+            if toIgnorePath == path {
+                indexToRemove = toIgnoreIndex
+                break
+            }
+        }
+        if indexToRemove > -1 {
+            //remove from toIgnore
+            toIgnore = append(toIgnore[:indexToRemove], toIgnore[indexToRemove+1:]...)
+            //skip dirs to ignore
+            if info.IsDir() {
+                return filepath.SkipDir
+            }
+            //don't do anything with file to ignore
+            return nil
+        }
+        //search dir for dirs/files to ignore
+        if info.IsDir() {
+            for _, patternToIgnore := range options.PatternsToIgnore {
+                toIgnoreMatches, _ := zglob.Glob(path + "/" + patternToIgnore)
+                toIgnore = append(toIgnore, toIgnoreMatches...)
+            }
+            return nil
+        }
+        send := func(file File) error {
+            select {
+                case ch <- file:
+                    return nil
+                case <-ctx.Done():
+                    return ctx.Err()
+            }
+        }
+        file := File{Path: path, Root: dirToSearch, ModTime: info.ModTime(), Size: info.Size()}
+        if options.SearchArchives && isArchive(path) {
+            return discoverInArchive(file, options, send)
+        }
+        //check file for shebang and send accordingly
+        if !file.hasShebang(options.FileShebangs) {
+            return nil
+        }
+        return send(file)
+    })
+}
+
+//Search searches files for query in order, sending a FileResult for each
+//file whose contents or path (depending on query.Target) match it
+func Search(ctx context.Context, files []File, query *Query) <-chan FileResult {
+    ch := make(chan FileResult)
+    go func() {
+        defer close(ch)
+        matcher := newMatcher(query)
+        buffer := make([]byte, SCAN_BUFFER_SIZE)
+        for _, file := range files {
+            var linesWithMatches []LineWithMatches
+            var stats fileStats
+            if query.matchesContent() {
+                linesWithMatches, stats = file.getLinesWithMatches(ctx, matcher, &buffer)
+                if ctx.Err() != nil {
+                    return
+                }
+            }
+            result := FileResult{File: file, LinesWithMatches: linesWithMatches}
+            if query.matchesPath() {
+                result.PathMatchIndeces, result.Score = file.getPathMatch(query)
+            }
+            if len(linesWithMatches) == 0 && result.PathMatchIndeces == nil {
+                continue
+            }
+            for i, line := range linesWithMatches {
+                if (i == 0 && result.PathMatchIndeces == nil) || line.Score > result.Score {
+                    result.Score = line.Score
+                }
+                result.NumberOfMatches += len(line.MatchIndeces)
+            }
+            result.Relevance = result.getRelevance(query, stats)
+            select {
+                case ch <- result:
+                case <-ctx.Done():
+                    return
+            }
+        }
+    }()
+    return ch
+}
+
+//IsModifiedSince returns whether the file has been modified since t, or
+//removed (see GetModTime())
+func (file File) IsModifiedSince(t time.Time) bool {
+    //to the second, for filesystems that keep modification times that
+    //coarsely
+    return !file.GetModTime().Before(t.Truncate(time.Second))
+}
+
+//GetModTime returns when the file was last modified, now if it was
+//removed. Virtual files are taken to have just been, as they can grow at
+//any time, and members of archives to have been when their archive was.
+func (file File) GetModTime() time.Time {
+    if file.IsVirtual() {
+        return time.Now()
+    }
+    info, err := os.Stat(file.GetPathOnDisk())
+    if err != nil {
+        return time.Now()
+    }
+    return info.ModTime()
+}
+
+//GetPathOnDisk returns the path of the file, or of its archive if it's a
+//member of one
+func (file File) GetPathOnDisk() string {
+    if file.IsArchiveMember() {
+        return file.ArchivePath
+    }
+    return file.Path
+}
+
+//RelativePath returns the path of the file relative to the directory it
+//was found in
+func (file File) RelativePath() string {
+    relativePath, err := filepath.Rel(file.Root, file.Path)
+    if err != nil || len(file.Root) == 0 || !strings.HasSuffix(file.Path, relativePath) {
+        return file.Path
+    }
+    return relativePath
+}
+
+//getPathMatch returns the offsets in file.Path of matches of query in the
+//file's relative path, nil if the relative path doesn't match the query,
+//along with the score of the match
+func (file File) getPathMatch(query *Query) ([][]int, int) {
+    relativePath := file.RelativePath()
+    match := query.matchLine(relativePath)
+    if match.hasNegatedTerm || !match.satisfiesAllGroups() {
+        return nil, 0
+    }
+    offset := len(file.Path) - len(relativePath)
+    for _, pair := range match.matchIndeces {
+        pair[0] += offset
+        pair[1] += offset
+    }
+    return match.matchIndeces, match.score
+}
+
+func (file File) hasShebang(fileShebangs []string) bool {
+    if len(fileShebangs) == 0 {
+        return true
+    }
+    found := false
+    file.eachLine(context.Background(), func(lineNo int, line string) bool {
+        for _, shebang := range fileShebangs {
+            if line == shebang {
+                found = true
+                return false
+            }
+        }
+        return true
+    })
+    return found
+}
+
+//Open opens the file for reading, decompressed if it's compressed (see
+//compressed.go), from its archive if it's an archive member and from
+//memory if it's virtual
+func (file File) Open() (io.ReadCloser, error) {
+    return openDecompressed(file.Path, func() (io.ReadCloser, error) {
+        if file.IsVirtual() {
+            return ioutil.NopCloser(bytes.NewReader(file.Buffer.Bytes())), nil
+        } else if file.IsArchiveMember() {
+            return openArchiveMember(file.ArchivePath, file.MemberName)
+        }
+        return os.Open(file.Path)
+    })
+}
+
+//ReadLines returns all of the lines of the file
+func (file File) ReadLines() ([]string, error) {
+    osFile, err := file.Open()
+    if err != nil {
+        return nil, err
+    }
+    defer osFile.Close()
+    var lines []string
+    scanner := bufio.NewScanner(osFile)
+    for scanner.Scan() {
+        lines = append(lines, scanner.Text())
+    }
+    return lines, scanner.Err()
+}
+
+//FirstLine returns the first line of the file, "" if it's empty
+func (file File) FirstLine() (string, error) {
+    osFile, err := file.Open()
+    if err != nil {
+        return "", err
+    }
+    defer osFile.Close()
+    scanner := bufio.NewScanner(osFile)
+    scanner.Scan()
+    return scanner.Text(), scanner.Err()
+}
+
+//eachLine calls f with each line of the file until f returns false or ctx
+//is done
+func (file File) eachLine(ctx context.Context, f func(lineNo int, line string) bool) {
+    osFile, err := file.Open()
+    if err != nil {
+        log.Printf("Could not open %v: %v", file.Path, err)
+        return
+    }
+    defer osFile.Close()
+    scanner := bufio.NewScanner(osFile)
+    lineNumber := 1
+    for scanner.Scan() {
+        if ctx.Err() != nil || !f(lineNumber, scanner.Text()) {
+            return
+        }
+        lineNumber ++
+    }
+}
+
+//getLinesWithMatches searches the file a chunk at a time (see scan.go),
+//buffer being the buffer chunks are read into. That's faster than matching
+//it a line at a time only because lines without any of the query's exact
+//terms are skipped: with fuzzy terms every line is matched, so it's about
+//as slow (see BenchmarkSearch).
+func (file File) getLinesWithMatches(ctx context.Context, matcher *matcher, buffer *[]byte) ([]LineWithMatches, fileStats) {
+    query := matcher.query
+    var linesWithMatches []LineWithMatches
+    var stats fileStats
+    satisfiedGroups := make([]bool, len(query.groups))
+    hasNegatedTerm := false
+    stats.numberOfLines = file.eachChunk(ctx, buffer, func(chunk []byte, firstLineNo int) bool {
+        if query.Scope != LINE_SCOPE && matcher.hasNegatedTerm(chunk) {
+            //no need to read the rest of a file that's ruled out
+            hasNegatedTerm = true
+            return false
+        }
+        if stats.headingLineNo == 0 {
+            stats.headingLineNo = findHeading(chunk, firstLineNo)
+        }
+        lineNumber := firstLineNo
+        //offset in chunk lineNumber was counted up to
+        countedTo := 0
+        for _, start := range matcher.getCandidateLineStarts(chunk) {
+            lineNumber += bytes.Count(chunk[countedTo:start], []byte{'\n'})
+            countedTo = start
+            lineBytes, _ := getLine(chunk, start)
+            line := string(lineBytes)
+            match := query.matchLine(line)
+            //line has to match the whole query on its own
+            if query.Scope == LINE_SCOPE && (match.hasNegatedTerm || !match.satisfiesAllGroups()) {
+                continue
+            }
+            for groupIndex, isSatisfied := range match.satisfiedGroups {
+                satisfiedGroups[groupIndex] = satisfiedGroups[groupIndex] || isSatisfied
+            }
+            if len(match.matchIndeces) > 0 {
+                linesWithMatches = append(linesWithMatches, LineWithMatches{
+                    LineNo: lineNumber,
+                    MatchIndeces: match.matchIndeces,
+                    Text: line,
+                    Score: match.score,
+                })
+            }
+        }
+        return true
+    })
+    if query.Scope != LINE_SCOPE {
+        if hasNegatedTerm {
+            return nil, stats
+        }
+        for _, isSatisfied := range satisfiedGroups {
+            if !isSatisfied {
+                return nil, stats
+            }
+        }
+    }
+    return linesWithMatches, stats
+}
+
+//getRelevance scores how relevant a file is to a query, going on how dense
+//the matches in it are, how many there are, whether the file's name, path or
+//first heading match, and the fuzzy match score
+func (result FileResult) getRelevance(query *Query, stats fileStats) float64 {
+    numberOfLines := math.Max(float64(stats.numberOfLines), 1)
+    density := float64(len(result.LinesWithMatches)) / numberOfLines
+    relevance := 100 * density + 10 * math.Log1p(float64(result.NumberOfMatches)) + float64(result.Score)
+    fileName := filepath.Base(result.File.Path)
+    if len(query.matchLine(fileName).matchIndeces) > 0 {
+        relevance += 50
+    } else if result.PathMatchIndeces != nil {
+        //matches in the names of directories the file is in
+        relevance += 25
+    }
+    for _, line := range result.LinesWithMatches {
+        if line.LineNo == stats.headingLineNo {
+            relevance += 25
+            break
+        }
+    }
+    return relevance
+}
@@ -0,0 +1,335 @@
+package search
+
+import (
+    "context"
+    "reflect"
+    "sort"
+    "testing"
+
+    "debounce_grep/internal/testfiles"
+)
+
+func discoverAll(options Options) []File {
+    var files []File
+    for file := range Discover(context.Background(), options) {
+        files = append(files, file)
+    }
+    return files
+}
+
+func getRelativePaths(files []File) []string {
+    var paths []string
+    for _, file := range files {
+        paths = append(paths, file.RelativePath())
+    }
+    sort.Strings(paths)
+    return paths
+}
+
+func TestDiscover(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{
+        "kafka.md": "*study\n# Kafka\n",
+        "draft.md": "# Draft\n*study\n",
+        "todo.txt": "no shebang here\n",
+        ".git/config": "*study\n",
+        "notes/cache.pyc": "*study\n",
+        "notes/zookeeper.md": "*study\n",
+    })
+    tests := []struct {
+        name string
+        options Options
+        want []string
+    }{
+        {
+            name: "all files",
+            options: Options{DirsToSearch: []string{dir}},
+            want: []string{".git/config", "draft.md", "kafka.md", "notes/cache.pyc", "notes/zookeeper.md", "todo.txt"},
+        },
+        {
+            name: "ignore patterns",
+            options: Options{DirsToSearch: []string{dir}, PatternsToIgnore: []string{".git", "*.pyc"}},
+            want: []string{"draft.md", "kafka.md", "notes/zookeeper.md", "todo.txt"},
+        },
+        {
+            name: "shebang on any line",
+            options: Options{DirsToSearch: []string{dir}, PatternsToIgnore: []string{".git", "*.pyc"}, FileShebangs: []string{"*study"}},
+            want: []string{"draft.md", "kafka.md", "notes/zookeeper.md"},
+        },
+        {
+            name: "unknown shebang",
+            options: Options{DirsToSearch: []string{dir}, FileShebangs: []string{"*journal"}},
+            want: nil,
+        },
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            got := getRelativePaths(discoverAll(test.options))
+            if !reflect.DeepEqual(got, test.want) {
+                t.Errorf("got %q, want %q", got, test.want)
+            }
+        })
+    }
+}
+
+//a cancelled Discover closes its channel instead of blocking on sending
+func TestDiscoverCancelled(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{"a.md": "a\n", "b.md": "b\n"})
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    for range Discover(ctx, Options{DirsToSearch: []string{dir}}) {
+    }
+}
+
+//searchAll searches all of the files under dir for query and returns the
+//relative path of each file that matched with the numbers of its lines
+//that matched
+func searchAll(t *testing.T, dir string, query *Query) map[string][]int {
+    files := discoverAll(Options{DirsToSearch: []string{dir}})
+    results := make(map[string][]int)
+    for result := range Search(context.Background(), files, query) {
+        var lineNos []int
+        for _, line := range result.LinesWithMatches {
+            lineNos = append(lineNos, line.LineNo)
+        }
+        results[result.File.RelativePath()] = lineNos
+    }
+    return results
+}
+
+func TestSearch(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{
+        "kafka.md": "# Kafka\nkafka log retention is 7 days\ncompaction keeps the last value\n",
+        "draft.md": "kafka retention, draft\n",
+        "rabbit.md": "no kafka here\n\nbut retention\r\n",
+        "zookeeper.md": "nothing to see\n",
+    })
+    tests := []struct {
+        name string
+        text string
+        scope Scope
+        fuzzy bool
+        want map[string][]int
+    }{
+        {
+            name: "file scope matches terms on different lines",
+            text: "kafka retention",
+            scope: FILE_SCOPE,
+            want: map[string][]int{"kafka.md": {2}, "draft.md": {1}, "rabbit.md": {1, 3}},
+        },
+        {
+            name: "line scope needs all terms on one line",
+            text: "kafka retention",
+            scope: LINE_SCOPE,
+            want: map[string][]int{"kafka.md": {2}, "draft.md": {1}},
+        },
+        {
+            name: "negated term rules out the file",
+            text: "retention -draft",
+            scope: FILE_SCOPE,
+            want: map[string][]int{"kafka.md": {2}, "rabbit.md": {3}},
+        },
+        {
+            name: "negated term rules out the line",
+            text: "kafka -here",
+            scope: LINE_SCOPE,
+            want: map[string][]int{"kafka.md": {2}, "draft.md": {1}},
+        },
+        {
+            name: "or group",
+            text: "compaction|nothing",
+            scope: FILE_SCOPE,
+            want: map[string][]int{"kafka.md": {3}, "zookeeper.md": {1}},
+        },
+        {
+            name: "phrase",
+            text: "\"last value\"",
+            scope: FILE_SCOPE,
+            want: map[string][]int{"kafka.md": {3}},
+        },
+        {
+            name: "exact terms are case sensitive",
+            text: "Kafka",
+            scope: FILE_SCOPE,
+            want: map[string][]int{"kafka.md": {1}},
+        },
+        {
+            name: "fuzzy",
+            text: "rtntn",
+            scope: FILE_SCOPE,
+            fuzzy: true,
+            want: map[string][]int{"kafka.md": {2}, "draft.md": {1}, "rabbit.md": {3}},
+        },
+        {
+            name: "no matches",
+            text: "rtntn",
+            scope: FILE_SCOPE,
+            want: map[string][]int{},
+        },
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            query, err := ParseQuery(test.text, test.scope)
+            if err != nil {
+                t.Fatal(err)
+            }
+            query.Fuzzy = test.fuzzy
+            got := searchAll(t, dir, query)
+            if !reflect.DeepEqual(got, test.want) {
+                t.Errorf("got %v, want %v", got, test.want)
+            }
+        })
+    }
+}
+
+func TestSearchMatchIndeces(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{"a.md": "kafka and kafka streams\n"})
+    query, err := ParseQuery("kafka|streams", FILE_SCOPE)
+    if err != nil {
+        t.Fatal(err)
+    }
+    files := discoverAll(Options{DirsToSearch: []string{dir}})
+    var results []FileResult
+    for result := range Search(context.Background(), files, query) {
+        results = append(results, result)
+    }
+    if len(results) != 1 || len(results[0].LinesWithMatches) != 1 {
+        t.Fatalf("got %+v, want one file with one line", results)
+    }
+    want := [][]int{{0, 5}, {10, 15}, {16, 23}}
+    if got := results[0].LinesWithMatches[0].MatchIndeces; !reflect.DeepEqual(got, want) {
+        t.Errorf("got %v, want %v", got, want)
+    }
+    if results[0].NumberOfMatches != 3 {
+        t.Errorf("got %v matches, want 3", results[0].NumberOfMatches)
+    }
+}
+
+func TestSearchPathTarget(t *testing.T) {
+    dir := testfiles.WriteFiles(t, map[string]string{"kafka/retention.md": "nothing\n", "notes.md": "kafka retention\n"})
+    query, err := ParseQuery("kafka retention", FILE_SCOPE)
+    if err != nil {
+        t.Fatal(err)
+    }
+    query.Target = PATH_TARGET
+    want := map[string][]int{"kafka/retention.md": nil}
+    if got := searchAll(t, dir, query); !reflect.DeepEqual(got, want) {
+        t.Errorf("got %v, want %v", got, want)
+    }
+}
+
+func TestParseQuery(t *testing.T) {
+    tests := []struct {
+        text string
+        wantGroups [][]queryTerm
+        wantNegatedTerms []string
+        wantErr bool
+    }{
+        {
+            text: "kafka retention",
+            wantGroups: [][]queryTerm{{{text: "kafka"}}, {{text: "retention"}}},
+        },
+        {
+            text: "retention|compaction kafka",
+            wantGroups: [][]queryTerm{{{text: "retention"}, {text: "compaction"}}, {{text: "kafka"}}},
+        },
+        {
+            text: "kafka -draft -\"to do\"",
+            wantGroups: [][]queryTerm{{{text: "kafka"}}},
+            wantNegatedTerms: []string{"draft", "to do"},
+        },
+        {
+            text: "\"consumer group\" lag",
+            wantGroups: [][]queryTerm{{{text: "consumer group", isPhrase: true}}, {{text: "lag"}}},
+        },
+        {
+            //still being typed
+            text: "kafka| \"consumer gr",
+            wantGroups: [][]queryTerm{{{text: "kafka"}, {text: "consumer gr", isPhrase: true}}},
+        },
+        {
+            //a lone - is a term
+            text: "a - b",
+            wantGroups: [][]queryTerm{{{text: "a"}}, {{text: "-"}}, {{text: "b"}}},
+        },
+        {
+            text: "-draft",
+            wantErr: true,
+        },
+        {
+            text: "kafka|-draft",
+            wantErr: true,
+        },
+        {
+            text: "   ",
+            wantErr: true,
+        },
+    }
+    for _, test := range tests {
+        query, err := ParseQuery(test.text, FILE_SCOPE)
+        if test.wantErr {
+            if err == nil {
+                t.Errorf("ParseQuery(%q) parsed, want an error", test.text)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("ParseQuery(%q): %v", test.text, err)
+            continue
+        }
+        if !reflect.DeepEqual(query.groups, test.wantGroups) || !reflect.DeepEqual(query.negatedTerms, test.wantNegatedTerms) {
+            t.Errorf("ParseQuery(%q) = %+v %q, want %+v %q", test.text, query.groups, query.negatedTerms, test.wantGroups, test.wantNegatedTerms)
+        }
+    }
+}
+
+func TestQueryNarrows(t *testing.T) {
+    tests := []struct {
+        name string
+        previous string
+        text string
+        fuzzy bool
+        //changes the query after parsing, if set
+        change func(query *Query)
+        want bool
+    }{
+        {name: "same query", previous: "kafka", text: "kafka", want: true},
+        {name: "term typed further", previous: "kaf", text: "kafka", want: true},
+        {name: "term backspaced", previous: "kafka", text: "kaf", want: false},
+        {name: "term added", previous: "kafka", text: "kafka retention", want: true},
+        {name: "term removed", previous: "kafka retention", text: "kafka", want: false},
+        {name: "term changed", previous: "kafka", text: "rabbit", want: false},
+        {name: "or group alternative removed", previous: "kafka|rabbit", text: "kafka", want: true},
+        {name: "or group alternative added", previous: "kafka", text: "kafka|rabbit", want: false},
+        {name: "or group alternative typed further", previous: "kafka|rabbit", text: "kafka|rabbitmq", want: true},
+        {name: "negated term added", previous: "kafka", text: "kafka -draft", want: true},
+        {name: "negated term removed", previous: "kafka -draft", text: "kafka", want: false},
+        //ruling out lines with dr rules out the ones with draft
+        {name: "negated term backspaced", previous: "kafka -draft", text: "kafka -dr", want: true},
+        {name: "negated term typed further", previous: "kafka -dr", text: "kafka -draft", want: false},
+        {name: "phrase typed further", previous: "\"consumer gr", text: "\"consumer group\"", want: true},
+        {name: "fuzzy term typed further", previous: "kfk", text: "kfka", fuzzy: true, want: true},
+        {name: "phrase implies fuzzy term", previous: "kafka", text: "\"kafka streams\"", fuzzy: true, want: true},
+        {name: "fuzzy term doesn't imply phrase", previous: "\"kafka\"", text: "kafka streams", fuzzy: true, want: false},
+        {name: "scope changed", previous: "kafka", text: "kafka retention", change: func(query *Query) { query.Scope = LINE_SCOPE }, want: false},
+        {name: "target changed", previous: "kafka", text: "kafka", change: func(query *Query) { query.Target = PATH_TARGET }, want: false},
+        {name: "fuzzy toggled", previous: "kafka", text: "kafka", change: func(query *Query) { query.Fuzzy = true }, want: false},
+    }
+    for _, test := range tests {
+        previous, err := ParseQuery(test.previous, FILE_SCOPE)
+        if err != nil {
+            t.Fatal(err)
+        }
+        previous.Fuzzy = test.fuzzy
+        query, err := ParseQuery(test.text, FILE_SCOPE)
+        if err != nil {
+            t.Fatal(err)
+        }
+        query.Fuzzy = test.fuzzy
+        if test.change != nil {
+            test.change(query)
+        }
+        if got := query.Narrows(previous); got != test.want {
+            t.Errorf("%v: %q narrows %q = %v, want %v", test.name, test.text, test.previous, got, test.want)
+        }
+    }
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+    "sync"
+    "time"
+)
+
+//Virtual files are searched from memory instead of from disk, e.g. text
+//piped to a program. Their content is a Buffer that can keep growing while
+//it's being searched: each search reads what has been written to it so far.
+
+type Buffer struct {
+    mutex sync.Mutex
+    content []byte
+}
+
+func NewBuffer() *Buffer {
+    return &Buffer{}
+}
+
+//Write appends p to the buffer
+func (buffer *Buffer) Write(p []byte) (int, error) {
+    buffer.mutex.Lock()
+    defer buffer.mutex.Unlock()
+    buffer.content = append(buffer.content, p...)
+    return len(p), nil
+}
+
+//Bytes returns what has been written to the buffer so far, which later
+//writes don't change
+func (buffer *Buffer) Bytes() []byte {
+    buffer.mutex.Lock()
+    defer buffer.mutex.Unlock()
+    return buffer.content[:len(buffer.content):len(buffer.content)]
+}
+
+func (buffer *Buffer) Len() int {
+    buffer.mutex.Lock()
+    defer buffer.mutex.Unlock()
+    return len(buffer.content)
+}
+
+//NewVirtualFile returns a File named name with the content of buffer, as
+//of now
+func NewVirtualFile(name string, buffer *Buffer) File {
+    return File{Path: name, ModTime: time.Now(), Size: int64(buffer.Len()), Buffer: buffer}
+}
+
+//IsVirtual returns whether the file is searched from memory rather than
+//from disk
+func (file File) IsVirtual() bool {
+    return file.Buffer != nil
+}
@@ -6,6 +6,7 @@ import (
     "github.com/maxmclau/gput"
     "log"
     "os"
+    "os/exec"
     "path/filepath"
     "io/ioutil"
 )
@@ -45,30 +46,34 @@ func PrintNewLine() {
 }
 
 func GetTtyDimensions() (int, int) {
-    lines := gput.Lines()
-    cols := gput.Cols()
+    //ask the tty itself first, since stdout isn't the tty when the output
+    //is piped or captured ($(debounce_grep))
+    var lines, cols int
+    output, err := exec.Command("stty", "-F", "/dev/tty", "size").Output()
+    if _, scanErr := fmt.Sscan(string(output), &lines, &cols); err != nil || scanErr != nil || lines == 0 || cols == 0 {
+        lines = gput.Lines()
+        cols = gput.Cols()
+    }
     log.Printf("Detected tty dimensions: %v x %v.", lines, cols)
     return lines, cols
 }
 
-func GetDirsToSearch() []string {
+func GetDirsToSearch(args []string) ([]string, error) {
     //looks first at cli args passed (not as flags starting with - or --),
     //if no dirs are passed as cli args this way, then returns just the cwd
     cwd := GetCurrentWorkingDir()
-    if len(os.Args[1:]) > 0 {
+    if len(args) > 0 {
         var dirs []string
-        var dir string
-        var err error
-        for _, arg := range os.Args[1:]{
-            dir,err = filepath.Abs(arg)
+        for _, arg := range args {
+            dir, err := filepath.Abs(arg)
             if err != nil {
-                panic(fmt.Sprintf("Could not resolve directory %s passed as CLI arg", dir))
+                return nil, fmt.Errorf("Could not resolve directory %s passed as CLI arg", arg)
             }
             dirs = append(dirs,dir)
         }
-        return dirs
+        return dirs, nil
     }
-    return []string{cwd}
+    return []string{cwd}, nil
 }
 
 func GetCurrentWorkingDir() string{
@@ -76,6 +81,12 @@ func GetCurrentWorkingDir() string{
     return currentWorkingDir
 }
 
-func init(){
-    SetUpLogging()
+//directory debounce_grep keeps its data (like query history) in, following
+//the XDG base directory spec: $XDG_DATA_HOME/debounce_grep, falling back
+//to $HOME/.local/share/debounce_grep
+func GetDataDir(xdgDataHome string, home string) string {
+    if len(xdgDataHome) > 0 {
+        return filepath.Join(xdgDataHome, "debounce_grep")
+    }
+    return filepath.Join(home, ".local", "share", "debounce_grep")
 }